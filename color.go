@@ -0,0 +1,74 @@
+package subcommander
+
+import (
+	"io"
+	"os"
+)
+
+// A ColorMode controls whether usage text is colored with ANSI escape
+// sequences.
+type ColorMode int
+
+const (
+	// ColorNever never colors usage text. It is the zero value.
+	ColorNever ColorMode = iota
+	// ColorAuto colors usage text when it is written to a terminal
+	// and the NO_COLOR environment variable is not set.
+	ColorAuto
+	// ColorAlways always colors usage text.
+	ColorAlways
+)
+
+// isTerminal reports whether stream is an *os.File connected to a
+// character device, such as a terminal, or a helpRecorder writing to
+// one. This is a cheap approximation that also accepts other character
+// devices, such as /dev/null.
+func isTerminal(stream interface{}) bool {
+	f, ok := outputFile(stream)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// outputFile returns the *os.File that stream writes to, if any.
+func outputFile(stream interface{}) (*os.File, bool) {
+	if recorder, ok := stream.(*helpRecorder); ok {
+		stream = recorder.out
+	}
+	f, ok := stream.(*os.File)
+	return f, ok
+}
+
+// A style applies ANSI colors to usage text, if it is enabled.
+type style bool
+
+// newStyle returns the style for usage text written to w in the
+// given mode.
+func newStyle(mode ColorMode, w io.Writer) style {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorAuto:
+		_, noColor := os.LookupEnv("NO_COLOR")
+		return style(!noColor && isTerminal(w))
+	}
+	return false
+}
+
+func (s style) apply(code, text string) string {
+	if !s || text == "" {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// heading colors section headings such as "Usage:".
+func (s style) heading(text string) string { return s.apply("1;33", text) }
+
+// name emphasizes command names.
+func (s style) name(text string) string { return s.apply("1", text) }
+
+// dim de-emphasizes descriptions.
+func (s style) dim(text string) string { return s.apply("2", text) }
@@ -3,9 +3,20 @@
 package subcommander
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 )
 
 type Config interface {
@@ -15,101 +26,1910 @@ type Config interface {
 
 // A Command defines a CLI subcommand and its handler.
 //
-// When the subcommand of the given Name is requested, the Run
-// function will be called with a Config given by the other CLI
-// options, and a slice of strings containing the non-flag CLI
-// arguments.
+// When the subcommand of the given Name, or any of its Aliases, is
+// requested, the Run function will be called with a Config given by
+// the other CLI options, and a slice of strings containing the
+// non-flag CLI arguments. Given -h, -help, or --help, the command
+// prints its usage instead, even if it declares flags of those names,
+// and Execute returns a *NeededHelpError.
 type Command struct {
-	Name            string
-	Description     string
-	Run             func(Config, []string) error
+	Name    string
+	Aliases []string
+
+	// Description is a one-line summary shown in the command listing.
+	Description string
+	// LongHelp is an optional longer body shown in the command's own
+	// usage.
+	LongHelp string
+	// Examples are sample invocations, each optionally followed by a
+	// note on the next line, shown at the end of the command's usage.
+	Examples []string
+
+	Run func(Config, []string) error
+	// RunContext, if set, is called instead of Run, and also receives
+	// the context passed to CommandSet.ExecuteContext.
+	RunContext func(context.Context, Config, []string) error
+	// RunIO, if set and RunContext is not, is called instead of Run,
+	// and also receives the CommandSet's IO streams.
+	RunIO func(IO, Config, []string) error
+	// RunParsed, if set and neither RunContext nor RunIO is, is called
+	// instead of Run with a ParsedArgs, which also gives access to the
+	// parsed flags.
+	RunParsed func(Config, *ParsedArgs) error
+
+	// Timeout, if positive, cancels the context passed to RunContext
+	// after that long. If the handler returns nil after the deadline
+	// has passed, the command's error wraps context.DeadlineExceeded.
+	// Timeout has no effect on the other handlers, which receive no
+	// context to watch.
+	Timeout time.Duration
+	// Retry, if Retry.Max is positive, runs the handler again after it
+	// returns a Retryable error, after waiting Retry.Backoff, up to
+	// Retry.Max times; any other error is returned at once. The
+	// Timeout applies to each run separately, and the set's PreRun,
+	// PostRun, and Middleware run only once around all of them. Only
+	// set Retry for commands that are safe to run more than once.
+	Retry RetryPolicy
+
+	// NumArgsRequired is the fewest non-flag arguments the command
+	// accepts. A command that requires arguments and is given nothing
+	// at all reports that before checking its flags.
 	NumArgsRequired int
+	// NumArgsMax, if positive, is the most non-flag arguments the
+	// command accepts; the error for too many names the unexpected
+	// ones. If it is 0 and the command has ArgSpecs, at most one
+	// argument per spec is accepted, unless the last spec is Variadic.
+	NumArgsMax int
+	// RequiredFlags names flags that must be given on the command line.
+	RequiredFlags []string
+	// ArgSpecs optionally describes the non-flag arguments in order.
+	// Each Required argument must be present, and each present
+	// argument must pass its spec's Validate function. The spec names
+	// are also shown in the command's usage line.
+	ArgSpecs []ArgSpec
+	// ArgsUsage, such as "<src> <dst>", describes the non-flag
+	// arguments in the command's usage line in place of the ArgSpecs
+	// names or the generic "[arguments]". It is also given to a
+	// UsageTemplate.
+	ArgsUsage string
+	// PromptForMissingArgs, if set, prompts the user for any missing
+	// required arguments when the standard input of the CommandSet's
+	// IO is a terminal, using the ArgSpecs names as prompts, instead
+	// of the command failing.
+	PromptForMissingArgs bool
+	// ExclusiveFlagGroups lists groups of flags of which at most one
+	// may be given on the command line.
+	ExclusiveFlagGroups [][]string
+	// FlagDependencies maps a flag to the flags that must also be
+	// given when it is given.
+	FlagDependencies map[string][]string
+
+	// ErrorHandling controls how flag parse errors are handled. The
+	// zero value is flag.ContinueOnError, so parse errors are returned
+	// from Execute; set it to flag.ExitOnError to exit the process
+	// instead.
+	ErrorHandling flag.ErrorHandling
+	// InterspersedFlags, if set, allows flags between and after the
+	// non-flag arguments; by default, flag parsing stops at the first
+	// non-flag argument, as with the flag package. Either way, a bare
+	// "--" among the flags ends flag parsing, and the arguments after
+	// it are passed to the handler as non-flag arguments even if they
+	// begin with a dash. Without InterspersedFlags, a "--" that
+	// follows a non-flag argument comes after the end of flag parsing,
+	// so it is itself passed to the handler, as in "x -- -y".
+	InterspersedFlags bool
+
+	// Hidden commands can be run, but are left out of usage listings,
+	// other than that of "help --all", suggestions, and completion.
+	Hidden bool
+	// Deprecated, if set, makes running the command print a warning
+	// that includes this message. The command is left out of the
+	// top-level usage unless every command is listed with "help --all"
+	// or "--help --all", where it is marked as deprecated.
+	Deprecated string
+
+	// RawArgs, if set, passes every argument after the command name to
+	// the handler unmodified, even those that look like flags. The
+	// command's flag declarations, flag checks, NumArgsRequired,
+	// NumArgsMax, and ArgSpecs are all ignored, as is -h.
+	RawArgs bool
+	// DisableHelpFlag, if set, parses -h, -help, and --help like any
+	// other flag, so the command can declare its own -h, for example
+	// as a shorthand for -host. Printing help is then up to the
+	// command; only flags named h or help that it leaves undeclared
+	// still print its usage, as the flag package does. "help
+	// <command>" always prints the usage.
+	DisableHelpFlag bool
+	// OnUnknownFlag, if set, is passed each argument that looks like a
+	// flag but names none of the command's flags, instead of making
+	// flag parsing fail. If it returns nil, the argument is dropped;
+	// otherwise Execute returns its error. Only the flag itself is
+	// passed, so an unknown flag's value must be joined to it, as in
+	// -name=value: a value given as a separate argument is taken as a
+	// non-flag argument, which also ends flag parsing unless
+	// InterspersedFlags is set.
+	OnUnknownFlag func(flagToken string) error
+
+	// Category is an optional heading under which the command is
+	// listed in the top-level usage.
+	Category string
+	// CompleteArgs, if set, returns the shell completion candidates
+	// for the command's non-flag arguments. It is given the arguments
+	// typed so far after the command name, the last of which, possibly
+	// empty, is the one being completed; the shell filters the
+	// candidates by that word. The completion scripts call it through
+	// the hidden "__complete" command.
+	CompleteArgs func(conf Config, args []string) []string
+	// SubCommands, if set, makes the command a group: instead of
+	// parsing flags and calling Run, the arguments after the command
+	// name are dispatched to the nested CommandSet.
+	SubCommands *CommandSet
+
+	// values, if not nil, holds the values of the run that this copy
+	// of the command was made for.
+	values *invocationValues
+}
+
+// ParsedArgs holds the arguments of a command after flag parsing.
+type ParsedArgs struct {
+	positional []string
+	flagSet    *flag.FlagSet
+	raw        []string
+	values     *invocationValues
+}
+
+// Positional returns the non-flag arguments.
+func (p *ParsedArgs) Positional() []string { return p.positional }
+
+// FlagSet returns the parsed FlagSet holding the command's flags.
+func (p *ParsedArgs) FlagSet() *flag.FlagSet { return p.flagSet }
+
+// Raw returns every argument after the command name, as given.
+func (p *ParsedArgs) Raw() []string { return p.raw }
+
+// An ArgSpec describes a non-flag argument of a Command. If Validate
+// is not nil, it is called with the argument's value and should
+// return an error if the value is unacceptable. The last ArgSpec of a
+// command may be Variadic, in which case it describes every argument
+// from its position on, any number of them, and each is validated.
+type ArgSpec struct {
+	Name     string
+	Required bool
+	Variadic bool
+	Validate func(string) error
 }
 
 // Match returns true if the given CLI arguments match this command.
+// Like os.Args, args must be a full argument vector, with the program
+// name at args[0] and the command name at args[1]; use MatchName to
+// match a command name alone.
 func (c *Command) Match(args []string) bool {
-	if len(args) < 2 || args[1] != c.Name {
-		return false
+	return len(args) >= 2 && c.MatchName(args[1])
+}
+
+// MatchName returns true if name is this command's Name or one of its
+// Aliases.
+func (c *Command) MatchName(name string) bool {
+	return c.matchName(name, false)
+}
+
+// matchName reports whether name is the command's Name or one of its
+// Aliases, optionally ignoring case.
+func (c *Command) matchName(name string, caseInsensitive bool) bool {
+	for _, candidate := range append([]string{c.Name}, c.Aliases...) {
+		if equalNames(name, candidate, caseInsensitive) {
+			return true
+		}
 	}
-	return true
+	return false
+}
+
+func equalNames(a, b string, caseInsensitive bool) bool {
+	if caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// label returns the command name as shown in usage listings.
+func (c *Command) label() string {
+	label := c.Name
+	if len(c.Aliases) > 0 {
+		label = fmt.Sprintf("%s (%s)", label, strings.Join(c.Aliases, ", "))
+	}
+	if c.SubCommands != nil {
+		label += " ..."
+	}
+	return label
 }
 
 // Execute parses the arguments, then runs the command handler.
 func (c *Command) Execute(conf Config, args []string) error {
-	flagSet := flag.NewFlagSet(c.Name, flag.ExitOnError)
-	conf.DeclareFlags(c.Name, flagSet)
-	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n\t %s %s [arguments]\n", args[0], c.Name)
-		flagSet.PrintDefaults()
+	return c.execute(context.Background(), &CommandSet{}, conf, args)
+}
+
+// execute is Execute with the settings of the enclosing CommandSet applied.
+func (c *Command) execute(ctx context.Context, cs *CommandSet, conf Config, args []string) error {
+	if c.SubCommands != nil {
+		return c.executeGroup(ctx, cs, conf, args)
 	}
-	if !c.Match(args) {
+	if !cs.match(c, args) {
 		return fmt.Errorf("Attempted to execute the %s command with the wrong command name", c.Name)
 	}
-	if err := flagSet.Parse(args[2:]); err != nil {
+	conf = cs.config(c, conf)
+	flagSet, envBound, err := c.newFlagSet(cs, conf, args[0])
+	if err != nil {
 		return err
 	}
+	if c.RawArgs {
+		return c.runChecked(ctx, cs, conf, &ParsedArgs{positional: args[2:], flagSet: flagSet, raw: args[2:]})
+	}
+	if !c.DisableHelpFlag && c.requestsHelp(flagSet, args[2:]) {
+		out := newHelpRecorder(cs.helpOutput())
+		flagSet.SetOutput(out)
+		c.writeUsage(out, newStyle(cs.Color, out), args[0], flagSet)
+		return out.neededHelp(c.Name)
+	}
+	if len(args) == 2 && c.NumArgsRequired > 0 && !c.PromptForMissingArgs {
+		// Nothing follows the command name, so report the missing
+		// arguments before any complaints about missing flags.
+		return &ArgCountError{CommandName: c.Name, Got: 0, Min: c.NumArgsRequired, Max: c.maxArgs()}
+	}
+	if cs.Defaults != nil {
+		if err := applyDefaults(flagSet, cs.Defaults(c.Name)); err != nil {
+			return err
+		}
+	}
+	flagArgs := args[2:]
+	if c.OnUnknownFlag != nil {
+		if flagArgs, err = c.removeUnknownFlags(flagSet, flagArgs); err != nil {
+			return err
+		}
+	}
+	usage := flagSet.Usage
+	if c.ErrorHandling == flag.ContinueOnError {
+		// The usage is printed below, so that help the user asked for
+		// is written with other help rather than with errors.
+		flagSet.Usage = func() {}
+	}
+	positional, err := c.parseFlags(flagSet, flagArgs)
+	flagSet.Usage = usage
+	if errors.Is(err, flag.ErrHelp) {
+		out := newHelpRecorder(cs.helpOutput())
+		flagSet.SetOutput(out)
+		c.writeUsage(out, newStyle(cs.Color, out), args[0], flagSet)
+		return out.neededHelp(c.Name)
+	}
+	if err != nil {
+		usage()
+		return &ParseError{CommandName: c.Name, Err: err, Suggestion: suggestFlag(flagSet, err)}
+	}
 	if !flagSet.Parsed() {
 		return fmt.Errorf("Could not parse arguments for the %q command.", c.Name)
 	}
-	if flagSet.NArg() < c.NumArgsRequired {
-		return fmt.Errorf("The '%s' command should have %d or more arguments\n", c.Name, c.NumArgsRequired)
+	fromEnv, err := applyEnv(flagSet, envBound, cs.EnvPrefix)
+	if err != nil {
+		return err
+	}
+	if err := c.checkRequiredFlags(flagSet, fromEnv); err != nil {
+		return err
+	}
+	if err := c.checkExclusiveFlags(flagSet); err != nil {
+		return err
+	}
+	if err := c.checkFlagDependencies(flagSet); err != nil {
+		return err
+	}
+	positional = c.promptForArgs(cs.IO.withDefaults(), positional)
+	if len(positional) < c.NumArgsRequired {
+		return &ArgCountError{CommandName: c.Name, Got: len(positional), Min: c.NumArgsRequired, Max: c.maxArgs()}
+	}
+	if max := c.maxArgs(); max > 0 && len(positional) > max {
+		return &ArgCountError{CommandName: c.Name, Got: len(positional), Min: c.NumArgsRequired, Max: max, Extra: positional[max:]}
+	}
+	if err := c.checkArgSpecs(positional); err != nil {
+		return err
+	}
+	err = c.runChecked(ctx, cs, conf, &ParsedArgs{positional: positional, flagSet: flagSet, raw: args[2:]})
+	if IsUsageError(err) {
+		flagSet.Usage()
+	}
+	return err
+}
+
+// runChecked runs the command with arguments that have passed all of
+// its checks, applying the set's DryRun and Logger settings.
+func (c *Command) runChecked(ctx context.Context, cs *CommandSet, conf Config, parsed *ParsedArgs) error {
+	positional := parsed.positional
+	if cs.DryRun {
+		c.printDryRun(cs.output(), parsed.flagSet, positional)
+		return nil
+	}
+	if c.Deprecated != "" {
+		fmt.Fprintf(cs.output(), "Warning: the %q command is deprecated: %s\n", c.Name, c.Deprecated)
+	}
+	if cs.Logger == nil {
+		return c.run(ctx, cs, conf, parsed)
+	}
+	start := time.Now()
+	cs.Logger.Info("command started", slog.Group("command", "name", c.Name, "args", len(positional), "flags", setFlagNames(parsed.flagSet)))
+	err := c.run(ctx, cs, conf, parsed)
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+	}
+	cs.Logger.Log(ctx, level, "command finished", slog.Group("command", "name", c.Name, "duration", time.Since(start), "error", err))
+	return err
+}
+
+// setFlagNames returns the names of the flags that were set on the
+// command line, in lexicographical order.
+func setFlagNames(flagSet *flag.FlagSet) []string {
+	var names []string
+	flagSet.Visit(func(f *flag.Flag) { names = append(names, f.Name) })
+	return names
+}
+
+// run calls the command's handler between the set's PreRun and
+// PostRun hooks, all wrapped in the set's Middleware.
+func (c *Command) run(ctx context.Context, cs *CommandSet, conf Config, parsed *ParsedArgs) error {
+	cs.markStarted(c.Name)
+	next := func() error {
+		// The hooks get a copy of the command carrying the values of
+		// this run, for WithValue and Value.
+		cmd := *c
+		cmd.values = newInvocationValues()
+		parsed.values = cmd.values
+		ctx := valuesContext{Context: ctx, values: cmd.values}
+		if cs.PreRun != nil {
+			if err := cs.PreRun(&cmd, conf, parsed.positional); err != nil {
+				return err
+			}
+		}
+		cs.markRan(c.Name)
+		err := c.runRetrying(ctx, cs.IO.withDefaults(), conf, parsed)
+		if cs.PostRun != nil {
+			return cs.PostRun(&cmd, conf, parsed.flagSet, parsed.positional, err)
+		}
+		return err
+	}
+	for i := len(cs.Middleware) - 1; i >= 0; i-- {
+		next = cs.Middleware[i](next)
+	}
+	return next()
+}
+
+// printDryRun describes the invocation that DryRun mode skipped.
+func (c *Command) printDryRun(out io.Writer, flagSet *flag.FlagSet, args []string) {
+	fmt.Fprintf(out, "Command: %s\n", c.Name)
+	fmt.Fprintf(out, "Flags:\n")
+	flagSet.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(out, "\t-%s=%q\n", f.Name, f.Value.String())
+	})
+	fmt.Fprintf(out, "Arguments: %q\n", args)
+}
+
+// hasHandler reports whether the command has a handler or
+// SubCommands to execute.
+func (c *Command) hasHandler() bool {
+	return c.Run != nil || c.RunContext != nil || c.RunIO != nil || c.RunParsed != nil || c.SubCommands != nil
+}
+
+// runHandler calls the first of RunContext, RunIO, RunParsed, and Run
+// that is set.
+func (c *Command) runHandler(ctx context.Context, streams IO, conf Config, parsed *ParsedArgs) error {
+	args := parsed.positional
+	if c.RunContext != nil {
+		return c.runContext(ctx, conf, args)
+	}
+	if c.RunIO != nil {
+		return c.RunIO(streams, conf, args)
+	}
+	if c.RunParsed != nil {
+		return c.RunParsed(conf, parsed)
+	}
+	if c.Run == nil {
+		return fmt.Errorf("The %q command has no Run handler", c.Name)
+	}
+	return c.Run(conf, args)
+}
+
+// runContext calls RunContext, applying the command's Timeout.
+func (c *Command) runContext(ctx context.Context, conf Config, args []string) error {
+	if c.Timeout <= 0 {
+		return c.RunContext(ctx, conf, args)
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	err := c.RunContext(ctx, conf, args)
+	if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("The %q command timed out after %v: %w", c.Name, c.Timeout, ctx.Err())
 	}
-	return c.Run(conf, flagSet.Args())
+	return err
 }
 
+// requestsHelp reports whether the flags in args include -h, -help,
+// or --help, even if the command declares flags of those names in
+// flagSet. The values of flagSet's flags are skipped.
+func (c *Command) requestsHelp(flagSet *flag.FlagSet, args []string) bool {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return false
+		case arg == "-h", arg == "-help", arg == "--help":
+			return true
+		case !strings.HasPrefix(arg, "-") && !c.InterspersedFlags:
+			return false
+		case takesValue(flagSet, arg):
+			i++
+		}
+	}
+	return false
+}
+
+// endsWithTerminator reports whether the parsed arguments end with a
+// "--" that ended flag parsing, rather than one that was the value of
+// the preceding flag.
+func endsWithTerminator(flagSet *flag.FlagSet, parsed []string) bool {
+	n := len(parsed)
+	if n == 0 || parsed[n-1] != "--" {
+		return false
+	}
+	return n < 2 || !takesValue(flagSet, parsed[n-2])
+}
+
+// removeUnknownFlags returns args without the flags that flagSet does
+// not define, after passing each of them to OnUnknownFlag. It stops
+// at the first error OnUnknownFlag returns. Like parseFlags, it stops
+// looking for flags at "--" and, unless InterspersedFlags is set, at
+// the first non-flag argument.
+func (c *Command) removeUnknownFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var kept []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		isFlag := strings.HasPrefix(arg, "-") && arg != "-"
+		if arg == "--" || !isFlag && !c.InterspersedFlags {
+			return append(kept, args[i:]...), nil
+		}
+		if !isFlag {
+			kept = append(kept, arg)
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"), "=")
+		if flagSet.Lookup(name) != nil || name == "h" || name == "help" {
+			kept = append(kept, arg)
+			if takesValue(flagSet, arg) && i+1 < len(args) {
+				i++
+				kept = append(kept, args[i])
+			}
+			continue
+		}
+		if err := c.OnUnknownFlag(arg); err != nil {
+			return nil, err
+		}
+	}
+	return kept, nil
+}
+
+// takesValue reports whether arg is a flag of flagSet that consumes
+// the following argument as its value.
+func takesValue(flagSet *flag.FlagSet, arg string) bool {
+	if !strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+		return false
+	}
+	f := flagSet.Lookup(strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-"))
+	return f != nil && !isBoolFlag(f)
+}
+
+// newFlagSet returns a FlagSet holding the global flags of cs, if
+// any, and the command's flag declarations, whose Usage function
+// prints the command's usage to the usage output of cs, along with
+// the names of the flags marked by BindEnv. A nil conf declares no
+// command flags. It is an error for a command flag to have the same
+// name as a global flag.
+func (c *Command) newFlagSet(cs *CommandSet, conf Config, programName string) (*flag.FlagSet, map[string]bool, error) {
+	out := cs.usageOutput()
+	flagSet := flag.NewFlagSet(c.Name, c.ErrorHandling)
+	bindings := &envBindings{Writer: out, names: map[string]bool{}}
+	flagSet.SetOutput(bindings)
+	defer flagSet.SetOutput(out)
+	flagSet.Usage = func() { c.writeUsage(out, newStyle(cs.Color, out), programName, flagSet) }
+	if cs.GlobalFlags != nil {
+		cs.GlobalFlags(flagSet)
+		for _, f := range c.declaredFlags(conf) {
+			if flagSet.Lookup(f.Name) != nil {
+				return flagSet, nil, fmt.Errorf("The -%s flag of the '%s' command has the same name as a global flag", f.Name, c.Name)
+			}
+		}
+	}
+	if conf != nil {
+		conf.DeclareFlags(c.Name, flagSet)
+	}
+	return flagSet, bindings.names, nil
+}
+
+// WriteUsage writes the command's usage, as printed for -h, to w: the
+// usage line, the LongHelp text, and the defaults of the flags that
+// conf declares for the command. If conf is nil, no flags are shown.
+func (c *Command) WriteUsage(w io.Writer, programName string, conf Config) {
+	(&CommandSet{}).writeCommandUsage(w, c, programName, conf)
+}
+
+// writeCommandUsage is WriteUsage with the settings of the set, such
+// as its GlobalFlags and Color, applied.
+func (cs *CommandSet) writeCommandUsage(w io.Writer, c *Command, programName string, conf Config) error {
+	flagSet, _, err := c.newFlagSet(cs, conf, programName)
+	if err != nil {
+		return err
+	}
+	flagSet.SetOutput(w)
+	c.writeUsage(w, newStyle(cs.Color, w), programName, flagSet)
+	return nil
+}
+
+func (c *Command) writeUsage(w io.Writer, s style, programName string, flagSet *flag.FlagSet) {
+	fmt.Fprintf(w, "%s\n\t %s %s\n", s.heading("Usage:"), s.name(programName+" "+c.Name), c.argsUsage())
+	if c.LongHelp != "" {
+		fmt.Fprintf(w, "\n%s\n\n", strings.TrimSpace(c.LongHelp))
+	}
+	flagSet.PrintDefaults()
+	if len(c.Examples) > 0 {
+		fmt.Fprintf(w, "\n%s\n", s.heading("Examples:"))
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, "\t%s\n", strings.ReplaceAll(strings.TrimSpace(example), "\n", "\n\t"))
+		}
+	}
+}
+
+// declaredFlags returns the flags the Config declares for the
+// command, in lexicographical order. A nil conf declares no flags.
+func (c *Command) declaredFlags(conf Config) []*flag.Flag {
+	if conf == nil {
+		return nil
+	}
+	flagSet := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	conf.DeclareFlags(c.Name, flagSet)
+	var flags []*flag.Flag
+	flagSet.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+// isBoolFlag reports whether the flag can be given without a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// parseFlags parses the flags in args and returns the non-flag
+// arguments. If the command allows InterspersedFlags, parsing resumes
+// after each non-flag argument until a "--" or the end of args.
+func (c *Command) parseFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	if err := flagSet.Parse(args); err != nil {
+		return nil, err
+	}
+	if !c.InterspersedFlags {
+		return flagSet.Args(), nil
+	}
+	var positional []string
+	for {
+		rest := flagSet.Args()
+		if len(rest) == 0 || endsWithTerminator(flagSet, args[:len(args)-len(rest)]) {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// checkRequiredFlags returns a *MissingFlagsError if any of the
+// command's RequiredFlags were set neither on the command line nor, as
+// listed in fromEnv, from the environment.
+func (c *Command) checkRequiredFlags(flagSet *flag.FlagSet, fromEnv map[string]bool) error {
+	if len(c.RequiredFlags) == 0 {
+		return nil
+	}
+	set := setFlags(flagSet)
+	var missing []string
+	for _, name := range c.RequiredFlags {
+		if !set[name] && !fromEnv[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingFlagsError{CommandName: c.Name, FlagNames: missing}
+	}
+	return nil
+}
+
+// maxArgs returns the most non-flag arguments the command accepts:
+// NumArgsMax if it is positive, or else the number of ArgSpecs unless
+// the last is Variadic. It returns 0 if there is no maximum.
+func (c *Command) maxArgs() int {
+	n := len(c.ArgSpecs)
+	if c.NumArgsMax > 0 || n == 0 || c.ArgSpecs[n-1].Variadic {
+		return c.NumArgsMax
+	}
+	return n
+}
+
+// checkArgSpecs checks the non-flag arguments against the command's
+// ArgSpecs.
+func (c *Command) checkArgSpecs(args []string) error {
+	for i, spec := range c.ArgSpecs {
+		if i >= len(args) {
+			if spec.Required {
+				return fmt.Errorf("The '%s' command requires the <%s> argument", c.Name, spec.Name)
+			}
+			continue
+		}
+		values := args[i : i+1]
+		if spec.Variadic {
+			values = args[i:]
+		}
+		for _, value := range values {
+			if spec.Validate == nil {
+				break
+			}
+			if err := spec.Validate(value); err != nil {
+				return fmt.Errorf("Invalid <%s> argument %q for the '%s' command: %v", spec.Name, value, c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// argsUsage returns the placeholder for the non-flag arguments shown
+// in the command's usage line.
+func (c *Command) argsUsage() string {
+	if c.ArgsUsage != "" {
+		return c.ArgsUsage
+	}
+	if len(c.ArgSpecs) == 0 {
+		return "[arguments]"
+	}
+	names := make([]string, len(c.ArgSpecs))
+	for i, spec := range c.ArgSpecs {
+		names[i] = "<" + spec.Name + ">"
+		if spec.Variadic {
+			names[i] += "..."
+		}
+		if !spec.Required {
+			names[i] = "[" + names[i] + "]"
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+// summary returns the command description as shown in usage listings.
+func (c *Command) summary() string {
+	if c.Deprecated != "" {
+		return strings.TrimSpace(c.Description + " (deprecated)")
+	}
+	return c.Description
+}
+
+// checkExclusiveFlags returns an error if more than one flag of any
+// of the command's ExclusiveFlagGroups was set on the command line.
+func (c *Command) checkExclusiveFlags(flagSet *flag.FlagSet) error {
+	if len(c.ExclusiveFlagGroups) == 0 {
+		return nil
+	}
+	set := setFlags(flagSet)
+	for _, group := range c.ExclusiveFlagGroups {
+		var conflicting []string
+		for _, name := range group {
+			if set[name] {
+				conflicting = append(conflicting, "-"+name)
+			}
+		}
+		if len(conflicting) > 1 {
+			return fmt.Errorf("The %s flags of the '%s' command cannot be used together", strings.Join(conflicting, ", "), c.Name)
+		}
+	}
+	return nil
+}
+
+// checkFlagDependencies returns an error if a flag in the command's
+// FlagDependencies was set on the command line without the flags it
+// requires.
+func (c *Command) checkFlagDependencies(flagSet *flag.FlagSet) error {
+	if len(c.FlagDependencies) == 0 {
+		return nil
+	}
+	set := setFlags(flagSet)
+	var names []string
+	for name := range c.FlagDependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !set[name] {
+			continue
+		}
+		var missing []string
+		for _, required := range c.FlagDependencies[name] {
+			if !set[required] {
+				missing = append(missing, "-"+required)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("The -%s flag of the '%s' command also requires the %s flag(s)", name, c.Name, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
+
+// applyDefaults sets each declared flag named in defaults to its value
+// there. Flags set this way do not count as given on the command line.
+func applyDefaults(flagSet *flag.FlagSet, defaults map[string]string) error {
+	for name, value := range defaults {
+		f := flagSet.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if err := f.Value.Set(value); err != nil {
+			return fmt.Errorf("Invalid default value %q for the -%s flag of the '%s' command: %v", value, name, flagSet.Name(), err)
+		}
+	}
+	return nil
+}
+
+// setFlags returns the names of the flags that have been set.
+func setFlags(flagSet *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// executeGroup dispatches the arguments after the command name to the
+// nested SubCommands set.
+func (c *Command) executeGroup(ctx context.Context, cs *CommandSet, conf Config, args []string) error {
+	if !cs.match(c, args) {
+		return fmt.Errorf("Attempted to execute the %s command with the wrong command name", c.Name)
+	}
+	sub := c.subCommandSet(cs, args[0])
+	return sub.executeArgs(ctx, conf, append([]string{sub.Name}, args[2:]...))
+}
+
+// subCommandSet returns a copy of the nested SubCommands set with
+// settings inherited from the enclosing set cs.
+func (c *Command) subCommandSet(cs *CommandSet, programName string) *CommandSet {
+	sub := *c.SubCommands
+	if sub.Name == "" {
+		sub.Name = programName + " " + c.Name
+	}
+	if sub.Output == nil {
+		sub.Output = cs.Output
+	}
+	sub.CaseInsensitive = sub.CaseInsensitive || cs.CaseInsensitive
+	sub.AllowPrefixMatch = sub.AllowPrefixMatch || cs.AllowPrefixMatch
+	sub.DryRun = sub.DryRun || cs.DryRun
+	sub.Quiet = sub.Quiet || cs.Quiet
+	if sub.IO.In == nil {
+		sub.IO.In = cs.IO.In
+	}
+	if sub.IO.Out == nil {
+		sub.IO.Out = cs.IO.Out
+	}
+	if sub.IO.Err == nil {
+		sub.IO.Err = cs.IO.Err
+	}
+	if sub.EnvPrefix == "" {
+		sub.EnvPrefix = cs.EnvPrefix
+	}
+	if sub.Defaults == nil {
+		sub.Defaults = cs.Defaults
+	}
+	if sub.Color == ColorNever {
+		sub.Color = cs.Color
+	}
+	if sub.GlobalFlags == nil {
+		sub.GlobalFlags = cs.GlobalFlags
+	}
+	if sub.Logger == nil {
+		sub.Logger = cs.Logger
+	}
+	if sub.PreRun == nil {
+		sub.PreRun = cs.PreRun
+	}
+	if sub.PostRun == nil {
+		sub.PostRun = cs.PostRun
+	}
+	if sub.Middleware == nil {
+		sub.Middleware = cs.Middleware
+	}
+	if sub.ConfigFactory == nil {
+		sub.ConfigFactory = cs.ConfigFactory
+	}
+	if sub.result == nil {
+		sub.result = cs.result
+	}
+	return &sub
+}
+
+// A CommandSet is a collection of Commands that make up a CLI program.
+//
+// When a CommandSet is nested in a group Command, it inherits from the
+// enclosing set any of Name, Output, EnvPrefix, Defaults, Logger,
+// GlobalFlags, Color, PreRun, PostRun, Middleware, ConfigFactory, and
+// the IO streams that it leaves unset, and CaseInsensitive,
+// AllowPrefixMatch, DryRun, and Quiet if the enclosing set enables
+// them.
 type CommandSet struct {
-	Name               string
+	// Name is the program name shown in usage text; if it is empty,
+	// the base name of os.Args[0] is used.
+	Name string
+	// DefaultCommandName, if set, names the command run when no
+	// command is named, and, unless a plugin or the FallbackCommand
+	// runs instead, when the first argument names no command. It
+	// receives every argument after the program name, so that
+	// "tool foo.txt" runs the default command with the argument
+	// foo.txt.
 	DefaultCommandName string
-	Commands           []Command
+	// Commands are the commands in the set. A command's Name may
+	// contain slashes, as in "remote/add", to group commands without
+	// nesting CommandSets. Such a command is invoked by its full name,
+	// and is listed in the top-level usage under the part of its name
+	// before the first slash unless it has a Category.
+	Commands []Command
+	// Output receives usage and error text. When it is nil, the text
+	// is written to flag.CommandLine.Output(), which defaults to
+	// stderr. Help that is asked for, with the "help" command or a -h
+	// or --help flag, is instead written to the standard output in IO,
+	// so that it can be piped to a pager.
+	Output io.Writer
+	// Version is printed by the built-in "version" command and the -v
+	// and --version flags. When it is empty, the main module version
+	// from the binary's build information is printed instead.
+	Version string
+
+	// PreRun and PostRun are optional hooks around every command in
+	// the set. For each command, the order is:
+	//
+	//  1. Flags and arguments are parsed and checked.
+	//  2. PreRun is called. If it returns an error, Execute returns
+	//     that error without running the command.
+	//  3. The command's handler is called.
+	//  4. PostRun is called with the command's parsed FlagSet, whose
+	//     Visit method gives the flags that were set, and the handler's
+	//     error, whether or not it is nil. Execute returns whatever
+	//     PostRun returns.
+	//
+	// The *Command passed to the hooks is a copy of the command made
+	// for the run, with which they can share values with the handler
+	// through WithValue and Value.
+	PreRun  func(cmd *Command, conf Config, args []string) error
+	PostRun func(cmd *Command, conf Config, flagSet *flag.FlagSet, args []string, runErr error) error
+
+	// CaseInsensitive makes command names and aliases, including the
+	// built-in "help", "version", and "commands" commands, match
+	// without regard to case.
+	CaseInsensitive bool
+	// AllowPrefixMatch lets a command also be invoked by any prefix of
+	// its Name that is not a prefix of another command's Name. Exact
+	// matches of names and aliases always take precedence.
+	AllowPrefixMatch bool
+	// DryRun makes Execute match commands and parse and check their
+	// flags and arguments as usual, but print the command name, flag
+	// values, and arguments to Output instead of running the command
+	// and the PreRun and PostRun hooks.
+	DryRun bool
+	// Quiet suppresses the usage and flag error text printed when the
+	// arguments are wrong or missing; Execute only returns the error,
+	// for programs that report errors themselves. Help that is asked
+	// for is still printed.
+	Quiet bool
+	// JSONErrors makes ExecuteAndExit print errors as JSON objects
+	// rather than as text; see ExecuteAndExit.
+	JSONErrors bool
+	// EnvPrefix is the prefix of the environment variables read for
+	// flags marked with BindEnv.
+	EnvPrefix string
+	// FallbackCommand, if set, is run whenever the arguments do not
+	// name any command in the set, and receives every argument after
+	// the program name, starting with the unrecognized command name,
+	// unless a plugin runs instead. Otherwise, and if there is no
+	// default command, Execute returns an *InvalidCommandError.
+	FallbackCommand *Command
+	// SortCommands makes the top-level usage list commands sorted by
+	// name rather than in the order of Commands. Categorized listings
+	// are always sorted. Sorting affects only the listing, not
+	// dispatch.
+	SortCommands bool
+	// IO holds the streams passed to RunIO handlers; see the IO type.
+	IO IO
+	// Defaults, if set, is called with the name of the command being
+	// run, and the returned values, such as those read from a config
+	// file, replace the built-in defaults of the corresponding flags.
+	// Flag values are thus taken, from lowest to highest precedence,
+	// from the flag declaration, Defaults, the environment (see
+	// BindEnv), and the command line. Values from Defaults do not
+	// count as setting a flag for RequiredFlags and the other flag
+	// checks. Values from the environment satisfy RequiredFlags, but
+	// otherwise do not count either, so they are not seen by
+	// FlagSet.Visit, PostRun, or the Logger.
+	Defaults func(commandName string) map[string]string
+	// Logger, if set, receives the start and end of each command run,
+	// with the command name, argument count, names of the flags set on
+	// the command line, duration, and error grouped under "command".
+	// Flag values are not logged, since they may be secrets.
+	Logger *slog.Logger
+	// GlobalFlags, if set, declares flags shared by every command on
+	// each command's FlagSet, before the command's own flags are
+	// declared. A command flag with the same name as a global flag is
+	// an error. Global flags may be given either before or after the
+	// command name. A global flag named v or version takes the place
+	// of the built-in -v or --version flag that prints the version.
+	GlobalFlags func(*flag.FlagSet)
+	// UsageTemplate, if set, prints the top-level usage when executed
+	// with a UsageData; DefaultUsageTemplate is a starting point.
+	UsageTemplate *template.Template
+	// UsageWidth, if set, is the width to which command descriptions
+	// in the top-level usage are always wrapped. Otherwise they are
+	// wrapped only when written to a terminal, to its width, taken
+	// from the COLUMNS environment variable or the terminal itself, or
+	// 80 columns if neither gives it.
+	UsageWidth int
+	// Color controls whether usage text is colored; see ColorMode.
+	Color ColorMode
+	// PluginPrefix, if set, makes an argument that names no command in
+	// the set run the executable on PATH named PluginPrefix followed
+	// by that argument, if there is one, with the remaining arguments,
+	// in the style of git. Plugins found on PATH are also listed in
+	// the top-level usage. Commands in the set always take precedence
+	// over plugins.
+	PluginPrefix string
+	// CommandEnvVar, if set, names the environment variable that names
+	// the command when none is named on the command line. The command
+	// to run is thus taken from the first of these that gives one: the
+	// command line, DefaultCommandName, and CommandEnvVar. If none
+	// does, Execute prints the top-level usage.
+	CommandEnvVar string
+	// AliasExpansions maps alias names to the arguments that replace
+	// them, in the style of git aliases: with an expansion of "ll" to
+	// []string{"list", "-long"}, "tool ll dir" runs "tool list -long
+	// dir". Aliases are matched like command names, so without regard
+	// to case if CaseInsensitive is set. Expansions are not themselves
+	// expanded, so an expansion that begins with another alias, or an
+	// alias with the name of a command, makes the set invalid.
+	AliasExpansions map[string][]string
+	// SplitNames lets a command whose Name contains slashes also be
+	// invoked with the parts of its name as separate arguments, as in
+	// "tool remote add".
+	SplitNames bool
+	// ConfigFactory, if set, is called with the name of the command to
+	// be run, and the Config it returns is used for that command in
+	// place of the one passed to Execute, so that each command can
+	// have its own configuration state.
+	ConfigFactory func(commandName string) Config
+	// Middleware wraps steps 2 through 4 of a run (see PreRun). Each
+	// function is given a next function that performs the rest of the
+	// run and returns its error; it may do work before and after
+	// calling next, skip calling it, or change the error it returns.
+	// Middleware[0] is the outermost wrapper, so it starts first and
+	// finishes last. Middleware is not run in DryRun mode.
+	Middleware []func(next func() error) func() error
+
+	// args, if not nil, is dispatched by Execute in place of os.Args.
+	args []string
+	// plugins caches the result of pluginNames.
+	plugins *[]string
+	// invokeDepth counts the calls to Invoke in progress.
+	invokeDepth int
+	// result, if not nil, is filled in by markRan.
+	result *executeResult
+}
+
+// executeResult records, for ExecuteResult and ExecuteAndExit, the
+// command whose checks passed and whose hooks and handler, or the
+// plugin, began to run, if any, and whether the handler or plugin
+// itself was run.
+type executeResult struct {
+	ran         bool
+	commandName string
+}
+
+// match reports whether args name the given command, applying the
+// set's matching rules.
+func (cs *CommandSet) match(c *Command, args []string) bool {
+	return len(args) >= 2 && c.matchName(args[1], cs.CaseInsensitive)
+}
+
+// name returns the program name: Name, or if that is empty, the base
+// name of the running binary.
+func (cs *CommandSet) name() string {
+	if cs.Name == "" {
+		return filepath.Base(os.Args[0])
+	}
+	return cs.Name
+}
+
+func (cs *CommandSet) output() io.Writer {
+	if cs.Output == nil {
+		return flag.CommandLine.Output()
+	}
+	return cs.Output
+}
+
+// config returns the Config for running the command: the one made by
+// ConfigFactory, if the set has one, or else conf.
+func (cs *CommandSet) config(c *Command, conf Config) Config {
+	if cs.ConfigFactory == nil {
+		return conf
+	}
+	return cs.ConfigFactory(c.Name)
+}
+
+// usageOutput returns the writer for usage and flag errors printed
+// because of a mistake in the arguments: Output, or io.Discard if the
+// set is Quiet.
+func (cs *CommandSet) usageOutput() io.Writer {
+	if cs.Quiet {
+		return io.Discard
+	}
+	return cs.output()
+}
+
+// helpOutput returns the writer for help that the user asked for: the
+// standard output of the set's IO streams.
+func (cs *CommandSet) helpOutput() io.Writer {
+	return cs.IO.withDefaults().Out
+}
+
+// A helpRecorder writes help to out and keeps a copy of it for the
+// NeededHelpError that reports it.
+type helpRecorder struct {
+	out  io.Writer
+	text strings.Builder
 }
 
-func (cs *CommandSet) printTopLevelUsage() {
-	fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n\t%s <command> [arguments]\n\n", cs.Name)
-	fmt.Fprintf(flag.CommandLine.Output(), "Commands:\n\n")
+func newHelpRecorder(out io.Writer) *helpRecorder {
+	return &helpRecorder{out: out}
+}
+
+func (r *helpRecorder) Write(p []byte) (int, error) {
+	r.text.Write(p)
+	return r.out.Write(p)
+}
+
+// neededHelp returns the error reporting that the help recorded by r
+// was printed for the named command, or for the whole set if
+// commandName is empty.
+func (r *helpRecorder) neededHelp(commandName string) *NeededHelpError {
+	return &NeededHelpError{CommandName: commandName, Text: r.text.String()}
+}
+
+// printHelp prints the usage of the command named by the first
+// element of topic, or the top-level usage if topic is empty. For a
+// group command, the rest of topic names a command in its nested set.
+func (cs *CommandSet) printHelp(conf Config, programName string, topic []string) error {
+	if len(topic) == 0 || showAll(topic) {
+		out := newHelpRecorder(cs.helpOutput())
+		cs.printTopLevelUsage(out, showAll(topic))
+		return out.neededHelp("")
+	}
 	for _, command := range cs.Commands {
-		fmt.Fprintf(flag.CommandLine.Output(), "%12s    %s\n", command.Name, command.Description)
+		if command.matchName(topic[0], cs.CaseInsensitive) {
+			if command.SubCommands != nil {
+				sub := command.subCommandSet(cs, programName)
+				return sub.printHelp(conf, sub.Name, topic[1:])
+			}
+			out := newHelpRecorder(cs.helpOutput())
+			if err := cs.writeCommandUsage(out, &command, programName, cs.config(&command, conf)); err != nil {
+				return err
+			}
+			return out.neededHelp(command.Name)
+		}
 	}
+	return cs.invalidCommand(topic[0])
 }
 
-func (cs *CommandSet) runDefaultCommand(conf Config) error {
+// printCommandNames prints the name of each command that is not
+// Hidden, one per line, to the standard output in IO.
+func (cs *CommandSet) printCommandNames() {
+	out := cs.IO.withDefaults().Out
 	for _, command := range cs.Commands {
-		args := []string{cs.Name, cs.DefaultCommandName}
-		if command.Match(args) {
-			return command.Execute(conf, args)
+		if !command.Hidden {
+			fmt.Fprintln(out, command.Name)
+		}
+	}
+}
+
+// showAll reports whether the arguments after a request for top-level
+// help are just --all, asking for every command to be listed.
+func showAll(args []string) bool {
+	return len(args) == 1 && args[0] == "--all"
+}
+
+func (cs *CommandSet) printVersion(w io.Writer) {
+	version := cs.Version
+	if version == "" {
+		version = "unknown"
+		if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+			version = info.Main.Version
+		}
+	}
+	fmt.Fprintf(w, "%s %s\n", cs.name(), version)
+}
+
+// envCommandName returns the command name given by the CommandEnvVar
+// environment variable, or the empty string if there is none.
+func (cs *CommandSet) envCommandName() string {
+	if cs.CommandEnvVar == "" {
+		return ""
+	}
+	return os.Getenv(cs.CommandEnvVar)
+}
+
+// runDefaultCommand runs the default command with args, the
+// arguments after the program name.
+func (cs *CommandSet) runDefaultCommand(ctx context.Context, conf Config, args []string) error {
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if command.matchName(cs.DefaultCommandName, cs.CaseInsensitive) {
+			return command.execute(ctx, cs, conf, append([]string{cs.name(), command.Name}, args...))
 		}
 	}
 	return fmt.Errorf("This command set does not define its own default command, %s", cs.DefaultCommandName)
 }
 
+// An InvalidCommandError is returned when the requested command does
+// not exist. If a known command name is close to the requested one,
+// it is given as the Suggestion. Available lists the names of the
+// commands that are not Hidden, for callers that want to show them;
+// Error does not include it.
 type InvalidCommandError struct {
 	CommandName string
+	Suggestion  string
+	Available   []string
 }
 
 func (e *InvalidCommandError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("%q is not a valid command.\nDid you mean %q?", e.CommandName, e.Suggestion)
+	}
 	return fmt.Sprintf("%q is not a valid command.", e.CommandName)
 }
 
-type NeededHelpError struct{}
+// Is reports whether target is ErrInvalidCommand, so that
+// errors.Is(err, ErrInvalidCommand) matches any *InvalidCommandError.
+func (e *InvalidCommandError) Is(target error) bool { return target == ErrInvalidCommand }
+
+// invalidCommand returns the *InvalidCommandError for the given
+// unknown command name.
+func (cs *CommandSet) invalidCommand(name string) *InvalidCommandError {
+	var available []string
+	for _, command := range cs.Commands {
+		if !command.Hidden {
+			available = append(available, command.Name)
+		}
+	}
+	return &InvalidCommandError{
+		CommandName: name,
+		Suggestion:  suggest(name, cs.commandNames()),
+		Available:   available,
+	}
+}
+
+// commandNames returns the names and aliases of every command in the
+// set that is not Hidden.
+func (cs *CommandSet) commandNames() []string {
+	var names []string
+	for _, command := range cs.Commands {
+		if command.Hidden {
+			continue
+		}
+		names = append(names, command.Name)
+		names = append(names, command.Aliases...)
+	}
+	return names
+}
+
+// An ArgCountError is returned when a command is given too few or too
+// many non-flag arguments. Min is the command's NumArgsRequired, and
+// Max the most arguments it accepts, given by NumArgsMax or its
+// ArgSpecs; a Max of 0 means no maximum. When there are too many
+// arguments, Extra holds those after the first Max, and the error
+// names them.
+type ArgCountError struct {
+	CommandName string
+	Got         int
+	Min         int
+	Max         int
+	Extra       []string
+}
+
+func (e *ArgCountError) Error() string {
+	switch {
+	case len(e.Extra) == 1:
+		return fmt.Sprintf("The '%s' command got an unexpected argument %q; it expects %s", e.CommandName, e.Extra[0], e.expected())
+	case len(e.Extra) > 1:
+		quoted := make([]string, len(e.Extra))
+		for i, arg := range e.Extra {
+			quoted[i] = strconv.Quote(arg)
+		}
+		return fmt.Sprintf("The '%s' command got unexpected arguments %s; it expects %s", e.CommandName, strings.Join(quoted, ", "), e.expected())
+	}
+	return fmt.Sprintf("The '%s' command expects %s, not %d", e.CommandName, e.expected(), e.Got)
+}
+
+// expected describes the allowed number of arguments.
+func (e *ArgCountError) expected() string {
+	switch {
+	case e.Max <= 0:
+		return fmt.Sprintf("at least %d argument(s)", e.Min)
+	case e.Min == e.Max:
+		return fmt.Sprintf("exactly %d argument(s)", e.Min)
+	case e.Min == 0:
+		return fmt.Sprintf("at most %d argument(s)", e.Max)
+	}
+	return fmt.Sprintf("between %d and %d arguments", e.Min, e.Max)
+}
+
+// A ParseError is returned when the flags of a command cannot be
+// parsed. Err is the error from the flag package. If the error is for
+// an undefined flag, Suggestion is the name of the closest declared
+// flag, if any is close enough to be a likely typo.
+type ParseError struct {
+	CommandName string
+	Err         error
+	Suggestion  string
+}
+
+func (e *ParseError) Error() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("Could not parse arguments for the %q command: %v\nDid you mean -%s?", e.CommandName, e.Err, e.Suggestion)
+	}
+	return fmt.Sprintf("Could not parse arguments for the %q command: %v", e.CommandName, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// An AmbiguousCommandError is returned when prefix matching is
+// enabled and the requested command is a prefix of several command
+// names, which are given as the Candidates.
+type AmbiguousCommandError struct {
+	CommandName string
+	Candidates  []string
+}
+
+func (e *AmbiguousCommandError) Error() string {
+	return fmt.Sprintf("%q is ambiguous; it could be any of: %s", e.CommandName, strings.Join(e.Candidates, ", "))
+}
+
+// A MissingFlagsError is returned when a command is run without some
+// of its RequiredFlags.
+type MissingFlagsError struct {
+	CommandName string
+	FlagNames   []string
+}
+
+func (e *MissingFlagsError) Error() string {
+	names := make([]string, len(e.FlagNames))
+	for i, name := range e.FlagNames {
+		names[i] = "-" + name
+	}
+	return fmt.Sprintf("The '%s' command requires the %s flag(s)", e.CommandName, strings.Join(names, ", "))
+}
+
+// A NeededHelpError is returned when usage or version information was
+// printed instead of running a command. Its Error method returns the
+// empty string, since there is nothing more to tell the user.
+type NeededHelpError struct {
+	// CommandName is the name of the command whose usage was
+	// printed, or the empty string if it was the usage of the whole
+	// set or the version.
+	CommandName string
+	// Text is what was printed, including any color codes. It is
+	// empty if the flag package printed the usage itself, as it does
+	// for an undeclared -h when DisableHelpFlag is set.
+	Text string
+}
 
 func (e *NeededHelpError) Error() string { return "" }
 
-// Execute matches the CLI arguments to a command, then runs that command.
+// Is reports whether target is ErrNeededHelp, so that
+// errors.Is(err, ErrNeededHelp) matches any *NeededHelpError.
+func (e *NeededHelpError) Is(target error) bool { return target == ErrNeededHelp }
+
+// usageError marks an error returned by UsageError.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string { return e.err.Error() }
+
+func (e *usageError) Unwrap() error { return e.err }
+
+// UsageError wraps err, which a command's handler returns, to show
+// that the command was used wrongly, so that Execute prints the
+// command's usage as well as returning the error. UsageError(nil)
+// returns nil.
+func UsageError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &usageError{err: err}
+}
+
+// IsUsageError reports whether err, or any error it wraps, was made
+// by UsageError.
+func IsUsageError(err error) bool {
+	var target *usageError
+	return errors.As(err, &target)
+}
+
+// Sentinel errors for use with errors.Is. Execute does not return
+// these values directly, but the errors it returns match them.
+var (
+	ErrNeededHelp     = errors.New("help needed")
+	ErrInvalidCommand = errors.New("invalid command")
+)
+
+// Validate checks the CommandSet for mistakes in its definition, such
+// as two commands that share a name or alias, a command with no
+// handler, or a DefaultCommandName that names no command. Execute
+// calls Validate before dispatching and returns any error it finds.
+func (cs *CommandSet) Validate() error {
+	for _, command := range cs.Commands {
+		if !command.hasHandler() {
+			return fmt.Errorf("The %q command has no Run handler", command.Name)
+		}
+		for i, spec := range command.ArgSpecs {
+			if spec.Variadic && i != len(command.ArgSpecs)-1 {
+				return fmt.Errorf("The <%s> argument of the %q command is Variadic but is not the last argument", spec.Name, command.Name)
+			}
+		}
+	}
+	if err := cs.checkNames(); err != nil {
+		return err
+	}
+	if cs.DefaultCommandName != "" && !cs.hasCommand(cs.DefaultCommandName) {
+		return fmt.Errorf("The default command %q is not defined", cs.DefaultCommandName)
+	}
+	if cs.FallbackCommand != nil && !cs.FallbackCommand.hasHandler() {
+		return fmt.Errorf("The fallback command %q has no Run handler", cs.FallbackCommand.Name)
+	}
+	for alias, expansion := range cs.AliasExpansions {
+		for other := range cs.AliasExpansions {
+			if cs.CaseInsensitive && other != alias && strings.EqualFold(other, alias) {
+				return fmt.Errorf("The aliases %q and %q differ only in case", alias, other)
+			}
+		}
+		if cs.hasCommand(alias) {
+			return fmt.Errorf("The alias %q has the same name as a command", alias)
+		}
+		if len(expansion) == 0 {
+			return fmt.Errorf("The alias %q expands to nothing", alias)
+		}
+		if _, ok := cs.aliasExpansion(expansion[0]); ok {
+			return fmt.Errorf("The alias %q expands to the alias %q, but aliases cannot refer to aliases", alias, expansion[0])
+		}
+	}
+	return nil
+}
+
+// checkNames returns an error if two commands share a name or alias.
+func (cs *CommandSet) checkNames() error {
+	seen := map[string]int{}
+	for i, command := range cs.Commands {
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+			key := name
+			if cs.CaseInsensitive {
+				key = strings.ToLower(name)
+			}
+			if j, ok := seen[key]; ok {
+				return fmt.Errorf("The name %q is used by both command %d and command %d", name, j, i)
+			}
+			seen[key] = i
+		}
+	}
+	return nil
+}
+
+// Add adds a command to the set. It returns an error, and leaves the
+// set unchanged, if the command's name or an alias is already in use.
+func (cs *CommandSet) Add(command Command) error {
+	return cs.AddAll(command)
+}
+
+// AddAll adds commands to the set. It returns an error, and adds none
+// of them, if any of their names or aliases are already in use or are
+// shared among them.
+func (cs *CommandSet) AddAll(commands ...Command) error {
+	candidate := *cs
+	candidate.Commands = append(append([]Command(nil), cs.Commands...), commands...)
+	if err := candidate.checkNames(); err != nil {
+		return err
+	}
+	cs.Commands = candidate.Commands
+	return nil
+}
+
+// Execute matches the CLI arguments in os.Args, or those given with
+// WithArgs, to a command, then runs that command.
 func (cs *CommandSet) Execute(conf Config) error {
-	if len(os.Args) < 2 {
+	return cs.ExecuteArgs(conf, cs.processArgs())
+}
+
+// processArgs returns the argument vector for Execute.
+func (cs *CommandSet) processArgs() []string {
+	if cs.args != nil {
+		return cs.args
+	}
+	return os.Args
+}
+
+// ExecuteArgs matches the given CLI arguments to a command, then runs
+// that command. The args slice is a full argument vector, so args[0]
+// is the program name and args[1] is the command name.
+//
+// Unless the set defines its own "help" command, "help <command>"
+// prints the usage of the named command, and a bare "help" prints the
+// top-level usage. Likewise "version", "-v", and "--version" print
+// the set's Version to the standard output in IO and return a
+// *NeededHelpError. A "commands"
+// command, unless the set defines its own, prints the names of the
+// commands that are not Hidden, one per line, to the standard output
+// in IO, for use in scripts, and returns nil.
+func (cs *CommandSet) ExecuteArgs(conf Config, args []string) error {
+	return cs.executeArgs(context.Background(), conf, args)
+}
+
+// ExecuteContext is like Execute, but passes ctx to the handler of
+// any command that sets RunContext.
+func (cs *CommandSet) ExecuteContext(ctx context.Context, conf Config) error {
+	return cs.executeArgs(ctx, conf, cs.processArgs())
+}
+
+// ExecuteResult is like Execute, but also reports whether a command's
+// handler, or a plugin, was run. If ran is true, err is the error that
+// the handler or the PostRun hook returned, or an error from running
+// the plugin; otherwise it is an error in matching the command or its
+// arguments, a *NeededHelpError, or nil in DryRun mode.
+func (cs *CommandSet) ExecuteResult(conf Config) (ran bool, err error) {
+	result, err := cs.executeResult(conf)
+	return result.ran, err
+}
+
+// executeResult is Execute, also returning what was run.
+func (cs *CommandSet) executeResult(conf Config) (executeResult, error) {
+	var result executeResult
+	set := *cs
+	set.result = &result
+	err := set.executeArgs(context.Background(), conf, set.processArgs())
+	return result, err
+}
+
+// markRan records, for ExecuteResult, that the handler of the named
+// command, or the plugin of that name, is being run. Only the first
+// run is recorded, so that commands run with Invoke do not count.
+func (cs *CommandSet) markRan(commandName string) {
+	if cs.result != nil && !cs.result.ran {
+		cs.markStarted(commandName)
+		cs.result.ran = true
+	}
+}
+
+// markStarted records, for ExecuteAndExit, that the named command
+// passed its checks and its run, starting with the PreRun hook and
+// Middleware, has begun. Only the first command is recorded.
+func (cs *CommandSet) markStarted(commandName string) {
+	if cs.result != nil && cs.result.commandName == "" {
+		cs.result.commandName = commandName
+	}
+}
+
+// maxInvokeDepth is the deepest that calls to Invoke may nest before
+// Invoke assumes the commands are invoking each other endlessly.
+const maxInvokeDepth = 32
+
+// Invoke runs the command with the given name or alias, as if args
+// had followed its name on the command line, so that one command's
+// handler can run another. The command's flags are declared and
+// parsed afresh from args and checked as usual. Invoke returns an
+// error rather than recursing if calls to it nest more than 32 deep.
+// The command is run with context.Background(); a RunContext handler
+// that invokes another command should use InvokeContext instead.
+func (cs *CommandSet) Invoke(name string, conf Config, args []string) error {
+	return cs.InvokeContext(context.Background(), name, conf, args)
+}
+
+// InvokeContext is like Invoke but runs the command with ctx, so that
+// it is canceled along with the command that invokes it.
+func (cs *CommandSet) InvokeContext(ctx context.Context, name string, conf Config, args []string) error {
+	if cs.invokeDepth >= maxInvokeDepth {
+		return fmt.Errorf("The %q command could not be invoked: commands were invoked more than %d levels deep", name, maxInvokeDepth)
+	}
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if command.matchName(name, cs.CaseInsensitive) {
+			cs.invokeDepth++
+			defer func() { cs.invokeDepth-- }()
+			return command.execute(ctx, cs, conf, append([]string{cs.name(), command.Name}, args...))
+		}
+	}
+	return cs.invalidCommand(name)
+}
+
+func (cs *CommandSet) executeArgs(ctx context.Context, conf Config, args []string) error {
+	if err := cs.Validate(); err != nil {
+		return err
+	}
+	args, err := cs.moveLeadingGlobalFlags(args)
+	if err != nil {
+		return err
+	}
+	args = cs.expandArgs(args)
+	if len(args) < 2 {
 		if cs.DefaultCommandName != "" {
-			return cs.runDefaultCommand(conf)
+			return cs.runDefaultCommand(ctx, conf, nil)
+		}
+		if name := cs.envCommandName(); name != "" {
+			programName := cs.name()
+			if len(args) > 0 {
+				programName = args[0]
+			}
+			return cs.executeArgs(ctx, conf, []string{programName, name})
+		}
+		out := newHelpRecorder(cs.usageOutput())
+		cs.printTopLevelUsage(out, false)
+		return out.neededHelp("")
+	}
+	command, err := cs.lookup(args)
+	if err != nil {
+		return err
+	}
+	if command != nil {
+		return command.execute(ctx, cs, conf, append([]string{args[0], command.Name}, args[2:]...))
+	}
+	switch {
+	case equalNames(args[1], "help", cs.CaseInsensitive):
+		return cs.printHelp(conf, args[0], args[2:])
+	case equalNames(args[1], "version", cs.CaseInsensitive), args[1] == "-v", args[1] == "--version":
+		out := newHelpRecorder(cs.helpOutput())
+		cs.printVersion(out)
+		return out.neededHelp("")
+	case args[1] == "-h", args[1] == "--help":
+		out := newHelpRecorder(cs.helpOutput())
+		cs.printTopLevelUsage(out, showAll(args[2:]))
+		return out.neededHelp("")
+	case equalNames(args[1], "commands", cs.CaseInsensitive):
+		cs.printCommandNames()
+		return nil
+	case args[1] == completeCommandName:
+		return cs.complete(conf, args[2:])
+	}
+	if ran, err := cs.runPlugin(ctx, args[1], args[2:]); ran {
+		cs.markRan(args[1])
+		return err
+	}
+	if cs.FallbackCommand != nil {
+		fallback := cs.FallbackCommand
+		return fallback.execute(ctx, cs, conf, append([]string{args[0], fallback.Name}, args[1:]...))
+	}
+	if cs.DefaultCommandName != "" {
+		return cs.runDefaultCommand(ctx, conf, args[1:])
+	}
+	return cs.invalidCommand(args[1])
+}
+
+// moveLeadingGlobalFlags returns args with any global flags that
+// precede the command name moved to just after it, where the
+// command's FlagSet will parse them, and the arguments after the
+// global flags expanded by expandArgs. If only global flags are given,
+// or they are followed by arguments for the default command, they are
+// moved after the name of the default command, or else of the command
+// named by CommandEnvVar, or dropped if there is neither.
+func (cs *CommandSet) moveLeadingGlobalFlags(args []string) ([]string, error) {
+	moved, err := cs.reorderGlobalFlags(args, cs.usageOutput())
+	if errors.Is(err, flag.ErrHelp) {
+		out := newHelpRecorder(cs.helpOutput())
+		cs.printTopLevelUsage(out, false)
+		return nil, out.neededHelp("")
+	}
+	if err != nil {
+		cs.printTopLevelUsage(cs.usageOutput(), false)
+		return nil, err
+	}
+	return moved, nil
+}
+
+// reorderGlobalFlags is moveLeadingGlobalFlags without printing usage
+// when the global flags cannot be parsed; the flag package's error
+// message is written to out.
+func (cs *CommandSet) reorderGlobalFlags(args []string, out io.Writer) ([]string, error) {
+	if cs.GlobalFlags == nil || len(args) < 2 || !strings.HasPrefix(args[1], "-") {
+		return args, nil
+	}
+	flagSet := cs.globalFlagStandIns()
+	if cs.isBuiltin(args[1]) && !isVersionFlagOf(flagSet, args[1]) {
+		return args, nil
+	}
+	flagSet.SetOutput(out)
+	flagSet.Usage = func() {}
+	if err := flagSet.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	rest := flagSet.Args()
+	globals := args[1 : len(args)-len(rest)]
+	if n := len(globals); n > 0 && globals[n-1] == "--" {
+		globals = globals[:n-1]
+	}
+	rest = cs.expandArgs(append([]string{args[0]}, rest...))[1:]
+	var commandName string
+	switch {
+	case len(rest) > 0 && !cs.forwardsToDefault(rest[0]):
+		commandName, rest = rest[0], rest[1:]
+	case cs.DefaultCommandName != "":
+		commandName = cs.DefaultCommandName
+	case cs.envCommandName() != "":
+		commandName = cs.envCommandName()
+	default:
+		return args[:1], nil
+	}
+	moved := append([]string{args[0], commandName}, globals...)
+	return append(moved, rest...), nil
+}
+
+// isVersionFlagOf reports whether token is the built-in -v or
+// --version flag and flagSet declares a flag of that name, which takes
+// its place.
+func isVersionFlagOf(flagSet *flag.FlagSet, token string) bool {
+	return (token == "-v" || token == "--version") && flagSet.Lookup(strings.TrimLeft(token, "-")) != nil
+}
+
+// globalFlagStandIns returns a FlagSet with a stand-in for each
+// global flag, for finding where the global flags before the command
+// name end. The stand-ins accept any value and discard it, so that
+// the global flags are set only once, by the command's FlagSet.
+func (cs *CommandSet) globalFlagStandIns() *flag.FlagSet {
+	declared := flag.NewFlagSet(cs.name(), flag.ContinueOnError)
+	cs.GlobalFlags(declared)
+	standIns := flag.NewFlagSet(cs.name(), flag.ContinueOnError)
+	declared.VisitAll(func(f *flag.Flag) {
+		standIns.Var(standInValue(isBoolFlag(f)), f.Name, f.Usage)
+	})
+	return standIns
+}
+
+// A standInValue is a flag.Value that discards what it is set to. It
+// is a bool flag if the global flag it stands in for is one.
+type standInValue bool
+
+func (v standInValue) String() string   { return "" }
+func (v standInValue) Set(string) error { return nil }
+func (v standInValue) IsBoolFlag() bool { return bool(v) }
+
+// expandArgs returns args with an alias in AliasExpansions at args[1]
+// replaced by its expansion, and a split name joined by joinSplitName.
+func (cs *CommandSet) expandArgs(args []string) []string {
+	if len(args) >= 2 {
+		if expansion, ok := cs.aliasExpansion(args[1]); ok {
+			args = append(append([]string{args[0]}, expansion...), args[2:]...)
+		}
+	}
+	return cs.joinSplitName(args)
+}
+
+// aliasExpansion returns the expansion of the named alias in
+// AliasExpansions, matching the name as command names are matched.
+func (cs *CommandSet) aliasExpansion(name string) ([]string, bool) {
+	if expansion, ok := cs.AliasExpansions[name]; ok {
+		return expansion, true
+	}
+	if cs.CaseInsensitive {
+		for alias, expansion := range cs.AliasExpansions {
+			if strings.EqualFold(alias, name) {
+				return expansion, true
+			}
 		}
-		cs.printTopLevelUsage()
-		return &NeededHelpError{}
+	}
+	return nil, false
+}
+
+// joinSplitName returns args with the longest run of tokens after the
+// program name that, joined with slashes, names a command replaced by
+// that name, so that "tool remote add" becomes "tool remote/add". A
+// first token that names a command itself is left alone, as are all
+// args unless SplitNames is set.
+func (cs *CommandSet) joinSplitName(args []string) []string {
+	if !cs.SplitNames || len(args) < 3 || cs.hasCommand(args[1]) {
+		return args
+	}
+	name, end := args[1], 0
+	for i := 2; i < len(args) && cs.hasNamePrefix(name+"/"); i++ {
+		name += "/" + args[i]
+		if cs.hasCommand(name) {
+			end = i
+		}
+	}
+	if end == 0 {
+		return args
+	}
+	joined := strings.Join(args[1:end+1], "/")
+	return append([]string{args[0], joined}, args[end+1:]...)
+}
+
+// hasNamePrefix reports whether any command's name or alias starts
+// with prefix.
+func (cs *CommandSet) hasNamePrefix(prefix string) bool {
+	if cs.CaseInsensitive {
+		prefix = strings.ToLower(prefix)
 	}
 	for _, command := range cs.Commands {
-		if command.Match(os.Args) {
-			return command.Execute(conf, os.Args)
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+			if cs.CaseInsensitive {
+				name = strings.ToLower(name)
+			}
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwardsToDefault reports whether Execute passes token, the first
+// argument after the program name, to the default command, because it
+// names no command, built-in, or plugin and there is no
+// FallbackCommand.
+func (cs *CommandSet) forwardsToDefault(token string) bool {
+	if cs.DefaultCommandName == "" || cs.FallbackCommand != nil || cs.isBuiltin(token) {
+		return false
+	}
+	if command, err := cs.lookup([]string{cs.name(), token}); command != nil || err != nil {
+		return false
+	}
+	if cs.PluginPrefix != "" {
+		for _, name := range cs.pluginNames() {
+			if name == token {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Lookup returns the command that Execute would run for the given
+// CLI arguments, without running it, and whether there is one. When
+// args names no command, it returns the default command, if any,
+// without checking for plugins or a FallbackCommand.
+func (cs *CommandSet) Lookup(args []string) (*Command, bool) {
+	args, err := cs.reorderGlobalFlags(args, io.Discard)
+	if err != nil {
+		return nil, false
+	}
+	args = cs.expandArgs(args)
+	if len(args) >= 2 {
+		command, err := cs.lookup(args)
+		if command != nil || err != nil || cs.isBuiltin(args[1]) {
+			return command, command != nil && err == nil
 		}
 	}
-	if os.Args[1] != "-h" && os.Args[1] != "--help" {
-		return &InvalidCommandError{CommandName: os.Args[1]}
+	if cs.DefaultCommandName == "" {
+		return nil, false
+	}
+	command, err := cs.lookup([]string{cs.name(), cs.DefaultCommandName})
+	return command, command != nil && err == nil
+}
+
+// Walk calls fn for every command in the set, including Hidden ones,
+// in the order of Commands. A group command is visited before the
+// commands of its nested set, which are visited in the same way. The
+// path holds the names of the enclosing group commands followed by the
+// command's own name, so for a command of the set itself it is just
+// its name. Each call gets a path of its own, which fn may keep. The
+// commands are passed by pointer into the sets, so fn may modify them.
+func (cs *CommandSet) Walk(fn func(path []string, c *Command)) {
+	cs.walk(nil, fn)
+}
+
+func (cs *CommandSet) walk(parent []string, fn func(path []string, c *Command)) {
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		path := append(parent[:len(parent):len(parent)], command.Name)
+		fn(path, command)
+		if command.SubCommands != nil {
+			command.SubCommands.walk(path, fn)
+		}
+	}
+}
+
+// ParseAndMatch finds the command among commands that the full
+// argument vector args names, as ExecuteArgs would with a CommandSet
+// of those commands, and returns it along with the arguments after
+// its name, without running anything. It returns an error if args
+// names no command, if two commands share a name or alias, or if
+// args[1] names no command, in which case the error is an
+// *InvalidCommandError.
+func ParseAndMatch(commands []Command, args []string) (*Command, []string, error) {
+	cs := &CommandSet{Commands: commands}
+	if err := cs.checkNames(); err != nil {
+		return nil, nil, err
+	}
+	if len(args) < 2 {
+		return nil, nil, errors.New("No command was given")
+	}
+	command, err := cs.lookup(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if command == nil {
+		return nil, nil, cs.invalidCommand(args[1])
+	}
+	return command, args[2:], nil
+}
+
+// lookup returns the command named by args[1], or nil if there is
+// none. Exact matches of names and aliases are tried first; then, if
+// args[1] is not a built-in command, prefix matches.
+func (cs *CommandSet) lookup(args []string) (*Command, error) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	for i := range cs.Commands {
+		if cs.match(&cs.Commands[i], args) {
+			return &cs.Commands[i], nil
+		}
+	}
+	if !cs.AllowPrefixMatch || cs.isBuiltin(args[1]) {
+		return nil, nil
+	}
+	return cs.matchPrefix(args[1])
+}
+
+// hasCommand reports whether name exactly matches a command's name or
+// alias.
+func (cs *CommandSet) hasCommand(name string) bool {
+	for i := range cs.Commands {
+		if cs.Commands[i].matchName(name, cs.CaseInsensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBuiltin reports whether token invokes built-in help or version
+// handling when no command in the set matches it.
+func (cs *CommandSet) isBuiltin(token string) bool {
+	switch token {
+	case "-h", "--help", "-v", "--version", completeCommandName:
+		return true
+	}
+	return equalNames(token, "help", cs.CaseInsensitive) || equalNames(token, "version", cs.CaseInsensitive) ||
+		equalNames(token, "commands", cs.CaseInsensitive)
+}
+
+// matchPrefix returns the one non-Hidden command whose Name starts
+// with prefix, or nil if there is none. If several commands match, it
+// returns an *AmbiguousCommandError.
+func (cs *CommandSet) matchPrefix(prefix string) (*Command, error) {
+	var matches []*Command
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		name, want := command.Name, prefix
+		if cs.CaseInsensitive {
+			name, want = strings.ToLower(name), strings.ToLower(want)
+		}
+		if !command.Hidden && strings.HasPrefix(name, want) {
+			matches = append(matches, command)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return matches[0], nil
+	}
+	err := &AmbiguousCommandError{CommandName: prefix}
+	for _, command := range matches {
+		err.Candidates = append(err.Candidates, command.Name)
 	}
-	cs.printTopLevelUsage()
-	return &NeededHelpError{}
+	return nil, err
 }
@@ -0,0 +1,353 @@
+package subcommander
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// noop is a Run handler that does nothing.
+func noop(Config, []string) error { return nil }
+
+// testConfig declares a bool flag -v and a string flag -name for
+// every command.
+type testConfig struct {
+	verbose bool
+	name    string
+}
+
+func (c *testConfig) DeclareFlags(commandName string, flagSet *flag.FlagSet) {
+	flagSet.BoolVar(&c.verbose, "v", false, "verbose output")
+	flagSet.StringVar(&c.name, "name", "", "a name")
+}
+
+func TestUnknownFlagReturnsError(t *testing.T) {
+	ran := false
+	streams := TestIO("")
+	cs := &CommandSet{Name: "tool", Output: streams.Err, IO: streams.IO, Commands: []Command{
+		{Name: "status", Run: func(Config, []string) error { ran = true; return nil }},
+	}}
+	err := cs.ExecuteArgs(&testConfig{}, []string{"tool", "status", "-bogus"})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("got error %v, want a *ParseError", err)
+	}
+	if ran {
+		t.Error("the command ran despite the unknown flag")
+	}
+}
+
+func FuzzParseAndMatch(f *testing.F) {
+	commands := []Command{
+		{Name: "status", Aliases: []string{"st"}, Run: noop},
+		{Name: "remote/add", Run: noop},
+		{Name: "help", Run: noop},
+	}
+	// Each input is an argument vector joined with NUL bytes; the
+	// empty string stands for an empty vector.
+	f.Add("")
+	f.Add("tool")
+	f.Add("\x00")
+	f.Add("tool\x00status\x00-v")
+	f.Add("tool\x00-v\x00--verbose\x00-x=1")
+	f.Add("-\x00--\x00-")
+	f.Add("tool\x00" + strings.Repeat("s", 1<<16))
+	f.Add("tool\x00status\x00" + strings.Repeat("-", 1<<16))
+	f.Fuzz(func(t *testing.T, joined string) {
+		var args []string
+		if joined != "" {
+			args = strings.Split(joined, "\x00")
+		}
+		command, rest, err := ParseAndMatch(commands, args)
+		if err != nil {
+			if command != nil || rest != nil {
+				t.Fatalf("ParseAndMatch(%q) returned %v, %q with error %v", args, command, rest, err)
+			}
+			return
+		}
+		if command == nil {
+			t.Fatalf("ParseAndMatch(%q) returned no command and no error", args)
+		}
+		if !command.MatchName(args[1]) {
+			t.Errorf("ParseAndMatch(%q) returned the %q command", args, command.Name)
+		}
+		if len(rest) != len(args)-2 {
+			t.Errorf("ParseAndMatch(%q) returned the arguments %q", args, rest)
+		}
+	})
+}
+
+func TestParseFlagsInterspersed(t *testing.T) {
+	tests := []struct {
+		name         string
+		interspersed bool
+		args         []string
+		positional   []string
+		verbose      bool
+		flagName     string
+	}{
+		{"flags before", true, []string{"-v", "-name", "x", "a", "b"}, []string{"a", "b"}, true, "x"},
+		{"flags between", true, []string{"a", "-v", "b", "-name=x", "c"}, []string{"a", "b", "c"}, true, "x"},
+		{"flags after", true, []string{"a", "b", "-v", "-name", "x"}, []string{"a", "b"}, true, "x"},
+		{"terminator", true, []string{"a", "--", "-v", "b"}, []string{"a", "-v", "b"}, false, ""},
+		{"terminator as value", true, []string{"-name", "--", "a", "-v"}, []string{"a"}, true, "--"},
+		{"stop at first positional", false, []string{"-v", "a", "-name", "x"}, []string{"a", "-name", "x"}, true, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := &testConfig{}
+			flagSet := flag.NewFlagSet("deploy", flag.ContinueOnError)
+			conf.DeclareFlags("deploy", flagSet)
+			c := &Command{Name: "deploy", InterspersedFlags: test.interspersed}
+			positional, err := c.parseFlags(flagSet, test.args)
+			if err != nil {
+				t.Fatalf("parseFlags(%q) returned %v", test.args, err)
+			}
+			if !reflect.DeepEqual(positional, test.positional) {
+				t.Errorf("parseFlags(%q) = %q, want %q", test.args, positional, test.positional)
+			}
+			if conf.verbose != test.verbose || conf.name != test.flagName {
+				t.Errorf("parseFlags(%q) set -v=%v -name=%q, want -v=%v -name=%q", test.args, conf.verbose, conf.name, test.verbose, test.flagName)
+			}
+		})
+	}
+}
+
+// retryableError is an error that can be retried.
+type retryableError struct{}
+
+func (retryableError) Error() string     { return "try again" }
+func (retryableError) IsRetryable() bool { return true }
+
+func TestDeprecationWarningPrintedOnce(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry RetryPolicy
+	}{
+		{"no retries", RetryPolicy{}},
+		{"with retries", RetryPolicy{Max: 3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runs := 0
+			var out strings.Builder
+			cs := &CommandSet{Name: "tool", Output: &out, Commands: []Command{{
+				Name:       "old",
+				Deprecated: "use new instead",
+				Retry:      test.retry,
+				Run: func(Config, []string) error {
+					runs++
+					if runs < 3 && test.retry.Max > 0 {
+						return retryableError{}
+					}
+					return nil
+				},
+			}}}
+			if err := cs.ExecuteArgs(nil, []string{"tool", "old"}); err != nil {
+				t.Fatalf("ExecuteArgs returned %v", err)
+			}
+			if test.retry.Max > 0 && runs != 3 {
+				t.Errorf("the handler ran %d times, want 3", runs)
+			}
+			warning := `Warning: the "old" command is deprecated: use new instead`
+			if n := strings.Count(out.String(), warning); n != 1 {
+				t.Errorf("the warning was printed %d times in:\n%s", n, out.String())
+			}
+		})
+	}
+}
+
+func TestTerminator(t *testing.T) {
+	tests := []struct {
+		name         string
+		interspersed bool
+		args         []string
+		positional   []string
+		verbose      bool
+	}{
+		{"flag before", false, []string{"-v", "--", "-name", "x"}, []string{"-name", "x"}, true},
+		{"flag after", false, []string{"--", "-v"}, []string{"-v"}, false},
+		{"after a non-flag argument", false, []string{"x", "--", "-v"}, []string{"x", "--", "-v"}, false},
+		{"interspersed flag before", true, []string{"a", "-v", "--", "-name"}, []string{"a", "-name"}, true},
+		{"interspersed flag after", true, []string{"a", "--", "b", "-v"}, []string{"a", "b", "-v"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conf := &testConfig{}
+			var got []string
+			cs := &CommandSet{Name: "tool", Commands: []Command{{
+				Name:              "run",
+				InterspersedFlags: test.interspersed,
+				Run:               func(_ Config, args []string) error { got = args; return nil },
+			}}}
+			args := append([]string{"tool", "run"}, test.args...)
+			if err := cs.ExecuteArgs(conf, args); err != nil {
+				t.Fatalf("ExecuteArgs(%q) returned %v", args, err)
+			}
+			if !reflect.DeepEqual(got, test.positional) {
+				t.Errorf("the handler got %q, want %q", got, test.positional)
+			}
+			if conf.verbose != test.verbose || conf.name != "" {
+				t.Errorf("-v=%v -name=%q, want -v=%v and no -name", conf.verbose, conf.name, test.verbose)
+			}
+		})
+	}
+}
+
+func TestLeadingGlobalFlagsSetOnce(t *testing.T) {
+	tests := [][]string{
+		{"tool", "status", "-verbose", "-tag", "a"},
+		{"tool", "-verbose", "-tag", "a", "status"},
+		{"tool", "-verbose", "status", "-tag", "a"},
+	}
+	for _, args := range tests {
+		var count int
+		var tags []string
+		cs := &CommandSet{
+			Name: "tool",
+			GlobalFlags: func(fs *flag.FlagSet) {
+				CountVar(fs, &count, "verbose", "verbosity")
+				StringSliceVar(fs, &tags, "tag", "a tag")
+			},
+			Commands: []Command{{Name: "status", Run: noop}},
+		}
+		if err := cs.ExecuteArgs(nil, args); err != nil {
+			t.Errorf("ExecuteArgs(%q) returned %v", args, err)
+			continue
+		}
+		if count != 1 || !reflect.DeepEqual(tags, []string{"a"}) {
+			t.Errorf("ExecuteArgs(%q) gave -verbose %d and -tag %q, want 1 and [a]", args, count, tags)
+		}
+	}
+}
+
+func TestGlobalVersionFlag(t *testing.T) {
+	var verbose bool
+	ran := false
+	streams := TestIO("")
+	cs := &CommandSet{
+		Name:        "tool",
+		IO:          streams.IO,
+		GlobalFlags: func(fs *flag.FlagSet) { fs.BoolVar(&verbose, "v", false, "verbose output") },
+		Commands:    []Command{{Name: "status", Run: func(Config, []string) error { ran = true; return nil }}},
+	}
+	if err := cs.ExecuteArgs(nil, []string{"tool", "-v", "status"}); err != nil {
+		t.Fatalf("ExecuteArgs returned %v", err)
+	}
+	if !ran || !verbose {
+		t.Errorf("status ran %v with -v=%v, want it run with -v", ran, verbose)
+	}
+	err := cs.ExecuteArgs(nil, []string{"tool", "--version"})
+	if !errors.Is(err, ErrNeededHelp) || streams.Stdout() == "" {
+		t.Errorf("--version returned %v and printed %q, want the version", err, streams.Stdout())
+	}
+}
+
+func TestLeadingGlobalFlagsBeforeAlias(t *testing.T) {
+	var verbose bool
+	var got []string
+	cs := &CommandSet{
+		Name:               "tool",
+		DefaultCommandName: "status",
+		AliasExpansions:    map[string][]string{"ll": {"list", "-name", "long"}},
+		GlobalFlags:        func(fs *flag.FlagSet) { fs.BoolVar(&verbose, "verbose", false, "verbose output") },
+		Commands: []Command{
+			{Name: "status", Run: noop},
+			{Name: "list", Run: func(_ Config, args []string) error { got = args; return nil }},
+		},
+	}
+	conf := &testConfig{}
+	if err := cs.ExecuteArgs(conf, []string{"tool", "-verbose", "ll", "x"}); err != nil {
+		t.Fatalf("ExecuteArgs returned %v", err)
+	}
+	if !verbose || conf.name != "long" || !reflect.DeepEqual(got, []string{"x"}) {
+		t.Errorf("list ran with -verbose=%v -name=%q and args %q, want -verbose -name=long and [x]", verbose, conf.name, got)
+	}
+}
+
+func TestLookupSkipsLeadingGlobalFlags(t *testing.T) {
+	var verbose bool
+	var name string
+	cs := &CommandSet{
+		Name: "tool",
+		GlobalFlags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&verbose, "verbose", false, "verbose output")
+			fs.StringVar(&name, "name", "", "a name")
+		},
+		Commands: []Command{{Name: "status", Run: noop}},
+	}
+	for _, args := range [][]string{
+		{"tool", "-verbose", "status"},
+		{"tool", "-name", "x", "--", "status"},
+	} {
+		if command, ok := cs.Lookup(args); !ok || command.Name != "status" {
+			t.Errorf("Lookup(%q) returned %v, %v, want the status command", args, command, ok)
+		}
+	}
+	if command, ok := cs.Lookup([]string{"tool", "-unknown", "status"}); ok {
+		t.Errorf("Lookup with an unknown global flag returned %v", command)
+	}
+}
+
+func TestLeadingGlobalFlagsWithCommandEnvVar(t *testing.T) {
+	t.Setenv("TOOL_COMMAND", "status")
+	var verbose bool
+	ran := false
+	cs := &CommandSet{
+		Name:          "tool",
+		CommandEnvVar: "TOOL_COMMAND",
+		GlobalFlags:   func(fs *flag.FlagSet) { fs.BoolVar(&verbose, "verbose", false, "verbose output") },
+		Commands:      []Command{{Name: "status", Run: func(Config, []string) error { ran = true; return nil }}},
+	}
+	if err := cs.ExecuteArgs(nil, []string{"tool", "-verbose"}); err != nil {
+		t.Fatalf("ExecuteArgs returned %v", err)
+	}
+	if !ran || !verbose {
+		t.Errorf("status ran %v with -verbose=%v, want it run with -verbose", ran, verbose)
+	}
+}
+
+func TestInvokeContextPassesCancellation(t *testing.T) {
+	var innerErr error
+	cs := &CommandSet{Name: "tool"}
+	cs.Commands = []Command{
+		{Name: "outer", RunContext: func(ctx context.Context, conf Config, _ []string) error {
+			return cs.InvokeContext(ctx, "inner", conf, nil)
+		}},
+		{Name: "inner", RunContext: func(ctx context.Context, _ Config, _ []string) error {
+			innerErr = ctx.Err()
+			return nil
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cs.executeArgs(ctx, nil, []string{"tool", "outer"}); err != nil {
+		t.Fatalf("executeArgs returned %v", err)
+	}
+	if !errors.Is(innerErr, context.Canceled) {
+		t.Errorf("the invoked command saw %v, want context.Canceled", innerErr)
+	}
+}
+
+func TestDisabledHelpFlagPrintsHelp(t *testing.T) {
+	for _, quiet := range []bool{false, true} {
+		streams := TestIO("")
+		cs := &CommandSet{Name: "tool", Quiet: quiet, Output: streams.Err, IO: streams.IO, Commands: []Command{
+			{Name: "status", DisableHelpFlag: true, Run: noop},
+		}}
+		err := cs.ExecuteArgs(&testConfig{}, []string{"tool", "status", "-h"})
+		var needed *NeededHelpError
+		if !errors.As(err, &needed) || needed.Text == "" {
+			t.Fatalf("with Quiet %v, ExecuteArgs returned %#v, want a *NeededHelpError with the help", quiet, err)
+		}
+		if streams.Stdout() != needed.Text || !strings.Contains(needed.Text, "-name") {
+			t.Errorf("with Quiet %v, printed %q to stdout, want the usage with the flags", quiet, streams.Stdout())
+		}
+		if streams.Stderr() != "" {
+			t.Errorf("with Quiet %v, printed %q to stderr", quiet, streams.Stderr())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package subcommander
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var nonIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// completeCommandName is the hidden built-in command that the
+// completion scripts run to complete command arguments.
+const completeCommandName = "__complete"
+
+// complete prints the completion candidates, one per line, for the
+// last of args, which are the words typed after the program name up
+// to the one being completed. The first word is completed from the
+// command names, and later ones by the command's CompleteArgs or, for
+// a group, by its nested set.
+func (cs *CommandSet) complete(conf Config, args []string) error {
+	out := cs.IO.withDefaults().Out
+	if len(args) <= 1 {
+		for _, name := range cs.commandNames() {
+			fmt.Fprintln(out, name)
+		}
+		return nil
+	}
+	// The last word is still being typed, so it is not expanded as an
+	// alias or joined into a split name.
+	last := len(args) - 1
+	args = append(cs.expandArgs(append([]string{cs.name()}, args[:last]...))[1:], args[last])
+	command, err := cs.lookup(append([]string{cs.name()}, args...))
+	if err != nil || command == nil {
+		return nil
+	}
+	if command.SubCommands != nil {
+		return command.subCommandSet(cs, cs.name()).complete(conf, args[1:])
+	}
+	if command.CompleteArgs == nil {
+		return nil
+	}
+	for _, candidate := range command.CompleteArgs(conf, args[1:]) {
+		fmt.Fprintln(out, candidate)
+	}
+	return nil
+}
+
+// completionFunctionName returns a shell function name derived from
+// the program name.
+func (cs *CommandSet) completionFunctionName() string {
+	return "_" + nonIdentifierChars.ReplaceAllString(cs.name(), "_")
+}
+
+// GenerateBashCompletion writes a bash completion script that
+// completes the first argument after the program name from the names
+// and aliases of the set's commands, other than Hidden ones. Later
+// arguments are completed by running the program's hidden
+// "__complete" command, which uses the commands' CompleteArgs.
+func (cs *CommandSet) GenerateBashCompletion(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `# bash completion for %[1]s
+
+%[2]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=( $(compgen -W '%[3]s' -- "$cur") )
+    else
+        local IFS=$'\n'
+        COMPREPLY=( $(compgen -W "$("${COMP_WORDS[0]}" %[4]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)" -- "$cur") )
+    fi
+}
+
+complete -F %[2]s %[1]s
+`, cs.name(), cs.completionFunctionName(), strings.Join(cs.commandNames(), " "), completeCommandName)
+	return err
+}
+
+// GenerateZshCompletion writes a zsh completion script that completes
+// the set's command names, showing each command's Description, and
+// the flags that conf declares for each command. If conf is nil, no
+// flags are completed. The arguments of commands with CompleteArgs,
+// and of group commands, are completed by running the program's
+// hidden "__complete" command.
+func (cs *CommandSet) GenerateZshCompletion(w io.Writer, conf Config) error {
+	var b strings.Builder
+	argsFunction := cs.completionFunctionName() + "_args"
+	fmt.Fprintf(&b, "#compdef %s\n\n", cs.name())
+	fmt.Fprintf(&b, "%s() {\n", argsFunction)
+	b.WriteString("    local -a candidates\n")
+	fmt.Fprintf(&b, "    candidates=(${(f)\"$($prog %s \"${(@)words[1,CURRENT]}\" 2>/dev/null)\"})\n", completeCommandName)
+	b.WriteString("    compadd -a candidates\n}\n\n")
+	fmt.Fprintf(&b, "%s() {\n", cs.completionFunctionName())
+	b.WriteString("    local prog=$words[1]\n")
+	b.WriteString("    local -a commands\n    commands=(\n")
+	for _, command := range cs.Commands {
+		if command.Hidden {
+			continue
+		}
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+			item := strings.ReplaceAll(name, ":", "\\:") + ":" + firstLine(command.Description)
+			fmt.Fprintf(&b, "        %s\n", zshQuote(item))
+		}
+	}
+	b.WriteString("    )\n\n")
+	b.WriteString("    if (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(&b, "        _describe -t commands %s commands\n", zshQuote(cs.name()+" command"))
+	b.WriteString("        return\n    fi\n\n")
+	b.WriteString("    shift words\n    (( CURRENT-- ))\n")
+	b.WriteString("    case $words[1] in\n")
+	for _, command := range cs.Commands {
+		var flags []*flag.Flag
+		if command.SubCommands == nil {
+			// A group parses no flags of its own, so everything after
+			// its name is completed by the completion command.
+			flags = command.declaredFlags(conf)
+		}
+		completesArgs := command.CompleteArgs != nil || command.SubCommands != nil
+		if command.Hidden || (len(flags) == 0 && !completesArgs) {
+			continue
+		}
+		names := append([]string{command.Name}, command.Aliases...)
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(names, "|"))
+		if len(flags) == 0 {
+			fmt.Fprintf(&b, "            %s\n            ;;\n", argsFunction)
+			continue
+		}
+		b.WriteString("            _arguments")
+		for _, f := range flags {
+			spec := "-" + f.Name + "[" + zshEscape(firstLine(f.Usage)) + "]"
+			if !isBoolFlag(f) {
+				spec += ":" + zshEscape(f.Name) + ":"
+			}
+			fmt.Fprintf(&b, " \\\n                %s", zshQuote(spec))
+		}
+		if completesArgs {
+			fmt.Fprintf(&b, " \\\n                %s", zshQuote("*:argument:"+argsFunction))
+		}
+		b.WriteString("\n            ;;\n")
+	}
+	b.WriteString("    esac\n}\n\n")
+	fmt.Fprintf(&b, "%s \"$@\"\n", cs.completionFunctionName())
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// zshQuote quotes s as a single-quoted shell word.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes the characters that are special in the
+// descriptions of an _arguments spec.
+func zshEscape(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,28 @@
+package subcommander
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestZshCompletionOfGroup(t *testing.T) {
+	cs := &CommandSet{Name: "tool", Commands: []Command{
+		{Name: "status", Run: noop},
+		{Name: "remote", SubCommands: &CommandSet{Commands: []Command{
+			{Name: "add", Run: noop},
+		}}},
+	}}
+	var script strings.Builder
+	if err := cs.GenerateZshCompletion(&script, &testConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	got := script.String()
+	group := got[strings.Index(got, "        remote)"):]
+	group = group[:strings.Index(group, ";;")]
+	if want := "remote)\n            _tool_args\n"; !strings.Contains(group, want) {
+		t.Errorf("the remote case is %q, want it to complete only with the args function", group)
+	}
+	if !strings.Contains(got, "'-name[a name]:name:'") {
+		t.Errorf("the status command's flags are not completed:\n%s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package subcommander
+
+import "encoding/json"
+
+type setDescription struct {
+	Name     string               `json:"name"`
+	Version  string               `json:"version,omitempty"`
+	Commands []commandDescription `json:"commands"`
+}
+
+type commandDescription struct {
+	Name        string               `json:"name"`
+	Aliases     []string             `json:"aliases,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Hidden      bool                 `json:"hidden,omitempty"`
+	Deprecated  string               `json:"deprecated,omitempty"`
+	Flags       []flagDescription    `json:"flags,omitempty"`
+	SubCommands []commandDescription `json:"subcommands,omitempty"`
+}
+
+type flagDescription struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+}
+
+// Describe returns a JSON description of the set for use by external
+// tools: its name and version, and for each command its name, aliases,
+// description, whether it is hidden, and either the flags that conf
+// declares for it or, for a group, the commands of its nested set.
+func (cs *CommandSet) Describe(conf Config) ([]byte, error) {
+	return json.MarshalIndent(setDescription{
+		Name:     cs.name(),
+		Version:  cs.Version,
+		Commands: cs.describeCommands(conf),
+	}, "", "  ")
+}
+
+func (cs *CommandSet) describeCommands(conf Config) []commandDescription {
+	descriptions := []commandDescription{}
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		description := commandDescription{
+			Name:        command.Name,
+			Aliases:     command.Aliases,
+			Description: command.Description,
+			Hidden:      command.Hidden,
+			Deprecated:  command.Deprecated,
+		}
+		if command.SubCommands != nil {
+			// A group parses no flags of its own; its commands do.
+			description.SubCommands = command.SubCommands.describeCommands(conf)
+		} else {
+			for _, f := range command.declaredFlags(conf) {
+				description.Flags = append(description.Flags, flagDescription{Name: f.Name, Default: f.DefValue, Usage: f.Usage})
+			}
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
@@ -0,0 +1,57 @@
+package subcommander
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDescribeRoundTrip(t *testing.T) {
+	cs := &CommandSet{Name: "tool", Version: "1.2.3", Commands: []Command{
+		{Name: "status", Aliases: []string{"st"}, Description: "Show the status", Run: noop},
+		{Name: "debug", Hidden: true, Run: noop},
+		{Name: "remote", SubCommands: &CommandSet{Commands: []Command{
+			{Name: "add", Description: "Add a remote", Run: noop},
+		}}},
+	}}
+	data, err := cs.Describe(&testConfig{})
+	if err != nil {
+		t.Fatalf("Describe returned %v", err)
+	}
+	// A tool consuming the output would declare its own types.
+	type flagInfo struct {
+		Name    string `json:"name"`
+		Default string `json:"default"`
+		Usage   string `json:"usage"`
+	}
+	type commandInfo struct {
+		Name        string        `json:"name"`
+		Aliases     []string      `json:"aliases"`
+		Description string        `json:"description"`
+		Hidden      bool          `json:"hidden"`
+		Flags       []flagInfo    `json:"flags"`
+		SubCommands []commandInfo `json:"subcommands"`
+	}
+	var got struct {
+		Name     string        `json:"name"`
+		Version  string        `json:"version"`
+		Commands []commandInfo `json:"commands"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("could not unmarshal %s: %v", data, err)
+	}
+	flags := []flagInfo{{"name", "", "a name"}, {"v", "false", "verbose output"}}
+	want := []commandInfo{
+		{Name: "status", Aliases: []string{"st"}, Description: "Show the status", Flags: flags},
+		{Name: "debug", Hidden: true, Flags: flags},
+		{Name: "remote", SubCommands: []commandInfo{
+			{Name: "add", Description: "Add a remote", Flags: flags},
+		}},
+	}
+	if got.Name != "tool" || got.Version != "1.2.3" {
+		t.Errorf("got name %q and version %q, want tool and 1.2.3", got.Name, got.Version)
+	}
+	if !reflect.DeepEqual(got.Commands, want) {
+		t.Errorf("got commands %+v, want %+v", got.Commands, want)
+	}
+}
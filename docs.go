@@ -0,0 +1,197 @@
+package subcommander
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GenerateMarkdown writes a Markdown page documenting the set: a list
+// of its commands with their descriptions, then a section for each
+// command with its LongHelp, usage line, and a table of the flags that
+// conf declares for it. The commands of nested groups are documented
+// under their full names. Hidden commands are left out.
+func (cs *CommandSet) GenerateMarkdown(w io.Writer, conf Config) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", cs.name())
+	b.WriteString("## Commands\n\n")
+	cs.writeMarkdownIndex(&b, cs.name())
+	cs.writeMarkdownSections(&b, cs.name(), conf)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (cs *CommandSet) writeMarkdownIndex(b *strings.Builder, programName string) {
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if command.Hidden {
+			continue
+		}
+		fmt.Fprintf(b, "- [`%s %s`](#%s)", programName, command.Name, markdownAnchor(programName+" "+command.Name))
+		if summary := command.summary(); summary != "" {
+			fmt.Fprintf(b, ": %s", summary)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+}
+
+func (cs *CommandSet) writeMarkdownSections(b *strings.Builder, programName string, conf Config) {
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if command.Hidden {
+			continue
+		}
+		fmt.Fprintf(b, "## %s %s\n\n", programName, command.Name)
+		if command.Description != "" {
+			fmt.Fprintf(b, "%s\n\n", command.summary())
+		}
+		if command.SubCommands != nil {
+			sub := command.subCommandSet(cs, programName)
+			sub.writeMarkdownIndex(b, sub.Name)
+			sub.writeMarkdownSections(b, sub.Name, conf)
+			continue
+		}
+		if command.LongHelp != "" {
+			fmt.Fprintf(b, "%s\n\n", strings.TrimSpace(command.LongHelp))
+		}
+		fmt.Fprintf(b, "```\n%s %s %s\n```\n\n", programName, command.Name, command.argsUsage())
+		writeMarkdownFlags(b, command.declaredFlags(conf))
+	}
+}
+
+func writeMarkdownFlags(b *strings.Builder, flags []*flag.Flag) {
+	if len(flags) == 0 {
+		return
+	}
+	b.WriteString("| Flag | Default | Usage |\n")
+	b.WriteString("| ---- | ------- | ----- |\n")
+	for _, f := range flags {
+		defValue := ""
+		if f.DefValue != "" {
+			defValue = "`" + markdownCell(f.DefValue) + "`"
+		}
+		fmt.Fprintf(b, "| `-%s` | %s | %s |\n", f.Name, defValue, markdownCell(f.Usage))
+	}
+	b.WriteString("\n")
+}
+
+// markdownCell escapes s for use in a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// markdownAnchor returns the anchor that common Markdown renderers
+// generate for a heading with the given text.
+func markdownAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9'):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// manPageName returns the name of the man page for the named command,
+// such as tool-remote-add for "remote/add" in the program "tool".
+func manPageName(programName, commandName string) string {
+	return strings.NewReplacer(" ", "-", "/", "-").Replace(programName + " " + commandName)
+}
+
+// GenerateManPage writes groff man page source for the command in the
+// given manual section, with NAME, SYNOPSIS, DESCRIPTION, and OPTIONS
+// sections derived from the command's Name, Description, LongHelp,
+// and the flags that conf declares for it.
+func (c *Command) GenerateManPage(w io.Writer, section int, programName string, conf Config) error {
+	var b strings.Builder
+	pageName := manPageName(programName, c.Name)
+	fmt.Fprintf(&b, ".TH \"%s\" \"%d\"\n", roffEscape(strings.ToUpper(pageName)), section)
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "%s", roffEscape(pageName))
+	if c.Description != "" {
+		fmt.Fprintf(&b, " \\- %s", roffEscape(c.summary()))
+	}
+	b.WriteString("\n.SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s %s\n%s\n", roffEscape(programName), roffEscape(c.Name), roffEscape(c.argsUsage()))
+	b.WriteString(".SH DESCRIPTION\n")
+	description := strings.TrimSpace(c.LongHelp)
+	if description == "" {
+		description = c.summary()
+	}
+	fmt.Fprintf(&b, "%s\n", roffText(description))
+	if flags := c.declaredFlags(conf); len(flags) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		for _, f := range flags {
+			valueName, usage := flag.UnquoteUsage(f)
+			b.WriteString(".TP\n")
+			fmt.Fprintf(&b, "\\fB\\-%s\\fR", roffEscape(f.Name))
+			if valueName != "" {
+				fmt.Fprintf(&b, " \\fI%s\\fR", roffEscape(valueName))
+			}
+			fmt.Fprintf(&b, "\n%s\n", roffText(usage))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// GenerateManPages writes a man page for each non-Hidden command in
+// the set, including the commands of nested groups, to the directory
+// dir. Each file is named after the program and command, such as
+// tool-status.1 for section 1.
+func (cs *CommandSet) GenerateManPages(dir string, section int, conf Config) error {
+	return cs.generateManPages(dir, section, cs.name(), conf)
+}
+
+func (cs *CommandSet) generateManPages(dir string, section int, programName string, conf Config) error {
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if command.Hidden {
+			continue
+		}
+		if command.SubCommands != nil {
+			sub := command.subCommandSet(cs, programName)
+			if err := sub.generateManPages(dir, section, sub.Name, conf); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s.%d", manPageName(programName, command.Name), section))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		err = command.GenerateManPage(f, section, programName, conf)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roffEscape escapes backslashes and dashes in s for use in roff text.
+func roffEscape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
+
+// roffText escapes s for use as roff body text, also protecting lines
+// that would otherwise be read as requests.
+func roffText(s string) string {
+	lines := strings.Split(roffEscape(s), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
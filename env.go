@@ -0,0 +1,73 @@
+package subcommander
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// envBindings collects the names of the flags that BindEnv marks
+// while a command's flags are declared. BindEnv is given only the
+// FlagSet, so newFlagSet makes an envBindings the FlagSet's output
+// for the duration of the declarations, writing through to the real
+// output.
+type envBindings struct {
+	io.Writer
+	names map[string]bool
+}
+
+// BindEnv marks the named flags in flagSet, which must already be
+// declared, so that when they are not given on the command line they
+// are set from the environment. Call it from DeclareFlags or
+// GlobalFlags; it has no effect on FlagSets that were not made for
+// running a command.
+//
+// The environment variable for a flag is the CommandSet's EnvPrefix
+// followed by the flag name, uppercased and with dashes replaced by
+// underscores: with an EnvPrefix of "TOOL_", the flag -api-token is
+// read from TOOL_API_TOKEN.
+func BindEnv(flagSet *flag.FlagSet, names ...string) {
+	bindings, _ := flagSet.Output().(*envBindings)
+	for _, name := range names {
+		if flagSet.Lookup(name) == nil {
+			panic(fmt.Sprintf("subcommander: BindEnv called for undeclared flag -%s", name))
+		}
+		if bindings != nil {
+			bindings.names[name] = true
+		}
+	}
+}
+
+// envVarName returns the environment variable read for a bound flag.
+func envVarName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets each flag named in bound that was not given on the
+// command line from its environment variable, if that is set, and
+// returns the names of the flags it set. Like the values from
+// Defaults, they do not count as given on the command line.
+func applyEnv(flagSet *flag.FlagSet, bound map[string]bool, prefix string) (map[string]bool, error) {
+	fromEnv := map[string]bool{}
+	if len(bound) == 0 {
+		return fromEnv, nil
+	}
+	set := setFlags(flagSet)
+	var err error
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if !bound[f.Name] || set[f.Name] || err != nil {
+			return
+		}
+		name := envVarName(prefix, f.Name)
+		if value, ok := os.LookupEnv(name); ok {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("Invalid value %q for the %s environment variable: %v", value, name, setErr)
+				return
+			}
+			fromEnv[f.Name] = true
+		}
+	})
+	return fromEnv, err
+}
@@ -0,0 +1,70 @@
+package subcommander
+
+import (
+	"flag"
+	"testing"
+)
+
+// envConfig declares a -token flag bound to the environment.
+type envConfig struct {
+	token string
+}
+
+func (c *envConfig) DeclareFlags(commandName string, flagSet *flag.FlagSet) {
+	flagSet.StringVar(&c.token, "token", "declared", "API token")
+	BindEnv(flagSet, "token")
+}
+
+func TestFlagValuePrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults map[string]string
+		env      string
+		args     []string
+		want     string
+	}{
+		{"declaration", nil, "", nil, "declared"},
+		{"defaults", map[string]string{"token": "default"}, "", nil, "default"},
+		{"environment", map[string]string{"token": "default"}, "env", nil, "env"},
+		{"command line", map[string]string{"token": "default"}, "env", []string{"-token", "cli"}, "cli"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				t.Setenv("TOOL_TOKEN", test.env)
+			}
+			conf := &envConfig{}
+			var visited []string
+			cs := &CommandSet{
+				Name:      "tool",
+				EnvPrefix: "TOOL_",
+				Defaults:  func(string) map[string]string { return test.defaults },
+				PostRun: func(_ *Command, _ Config, flagSet *flag.FlagSet, _ []string, err error) error {
+					flagSet.Visit(func(f *flag.Flag) { visited = append(visited, f.Name) })
+					return err
+				},
+				Commands: []Command{{Name: "get", Run: noop}},
+			}
+			args := append([]string{"tool", "get"}, test.args...)
+			if err := cs.ExecuteArgs(conf, args); err != nil {
+				t.Fatalf("ExecuteArgs(%q) returned %v", args, err)
+			}
+			if conf.token != test.want {
+				t.Errorf("-token is %q, want %q", conf.token, test.want)
+			}
+			if wantVisited := len(test.args) > 0; (len(visited) > 0) != wantVisited {
+				t.Errorf("flags seen as set on the command line: %q", visited)
+			}
+		})
+	}
+}
+
+func TestEnvironmentSatisfiesRequiredFlags(t *testing.T) {
+	t.Setenv("TOOL_TOKEN", "env")
+	cs := &CommandSet{Name: "tool", EnvPrefix: "TOOL_", Commands: []Command{
+		{Name: "get", RequiredFlags: []string{"token"}, Run: noop},
+	}}
+	if err := cs.ExecuteArgs(&envConfig{}, []string{"tool", "get"}); err != nil {
+		t.Errorf("ExecuteArgs returned %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package subcommander
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// An ExitCoder is an error that carries the process exit code a
+// program should use when the error is returned from a command.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ExitCodeFor returns the process exit code for an error returned by
+// CommandSet.Execute, so that a program's main function can end with
+//
+//	os.Exit(subcommander.ExitCodeFor(err))
+//
+// The mapping is:
+//
+//   - nil: 0
+//   - an error implementing ExitCoder: its ExitCode()
+//   - *InvalidCommandError: 2
+//   - *NeededHelpError: 0
+//   - any other error: 1
+//
+// Wrapped errors are unwrapped with errors.As.
+func ExitCodeFor(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCoder ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+	var invalidCommand *InvalidCommandError
+	if errors.As(err, &invalidCommand) {
+		return 2
+	}
+	var neededHelp *NeededHelpError
+	if errors.As(err, &neededHelp) {
+		return 0
+	}
+	return 1
+}
+
+// ExecuteAndExit runs Execute, prints any error other than a
+// *NeededHelpError to stderr, and exits the process with the code
+// given by ExitCodeFor. It always calls os.Exit, even on success, so
+// it should be the last call in main and must not be used in tests.
+//
+// If the set's JSONErrors is set, the error is printed as a JSON
+// object on one line, such as
+//
+//	{"error":"\"stats\" is not a valid command.","command":"stats","kind":"invalid_command"}
+//
+// for programs that run the CLI and need to tell errors apart. The
+// command is the name of the command that failed, omitted if it is not
+// known, and the kind is one of:
+//
+//   - "invalid_command": no command, or several, matched the name given
+//   - "parse": the command's flags could not be parsed
+//   - "usage": the arguments were otherwise wrong, or the handler
+//     returned an error made with UsageError
+//   - "handler": the handler, the PreRun hook or Middleware run
+//     before it, or a plugin failed
+func (cs *CommandSet) ExecuteAndExit(conf Config) {
+	result, err := cs.executeResult(conf)
+	if err != nil && !errors.Is(err, ErrNeededHelp) {
+		if cs.JSONErrors {
+			printJSONError(os.Stderr, err, result)
+		} else {
+			fmt.Fprintln(os.Stderr, strings.TrimRight(err.Error(), "\n"))
+		}
+	}
+	os.Exit(ExitCodeFor(err))
+}
+
+// A jsonError is an error as printed in JSONErrors mode.
+type jsonError struct {
+	Error   string `json:"error"`
+	Command string `json:"command,omitempty"`
+	Kind    string `json:"kind"`
+}
+
+// printJSONError prints err to w as a jsonError. result tells whether
+// err came from running a command.
+func printJSONError(w io.Writer, err error, result executeResult) {
+	out := jsonError{Error: strings.TrimRight(err.Error(), "\n"), Command: result.commandName, Kind: "handler"}
+	var (
+		invalidCommand *InvalidCommandError
+		ambiguous      *AmbiguousCommandError
+		parseErr       *ParseError
+		argCount       *ArgCountError
+		missingFlags   *MissingFlagsError
+	)
+	switch {
+	case IsUsageError(err):
+		out.Kind = "usage"
+	case result.commandName != "":
+		// The command's PreRun hook, Middleware, or handler failed.
+	case errors.As(err, &invalidCommand):
+		out.Command, out.Kind = invalidCommand.CommandName, "invalid_command"
+	case errors.As(err, &ambiguous):
+		out.Command, out.Kind = ambiguous.CommandName, "invalid_command"
+	case errors.As(err, &parseErr):
+		out.Command, out.Kind = parseErr.CommandName, "parse"
+	case errors.As(err, &argCount):
+		out.Command, out.Kind = argCount.CommandName, "usage"
+	case errors.As(err, &missingFlags):
+		out.Command, out.Kind = missingFlags.CommandName, "usage"
+	default:
+		out.Kind = "usage"
+	}
+	// Encoding a struct of strings cannot fail.
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,51 @@
+package subcommander
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONErrorKinds(t *testing.T) {
+	failing := errors.New("not logged in")
+	tests := []struct {
+		name    string
+		preRun  error
+		args    []string
+		command string
+		kind    string
+	}{
+		{"PreRun", failing, []string{"tool", "status", "x"}, "status", "handler"},
+		{"handler", nil, []string{"tool", "fail"}, "fail", "handler"},
+		{"arguments", nil, []string{"tool", "status"}, "status", "usage"},
+		{"command", nil, []string{"tool", "bogus"}, "bogus", "invalid_command"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cs := &CommandSet{
+				Name:   "tool",
+				Quiet:  true,
+				PreRun: func(*Command, Config, []string) error { return test.preRun },
+				Commands: []Command{
+					{Name: "status", NumArgsRequired: 1, Run: noop},
+					{Name: "fail", Run: func(Config, []string) error { return failing }},
+				},
+			}
+			cs.args = test.args
+			result, err := cs.executeResult(nil)
+			if err == nil {
+				t.Fatal("executeResult returned no error")
+			}
+			var out strings.Builder
+			printJSONError(&out, err, result)
+			var got jsonError
+			if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+				t.Fatalf("could not unmarshal %s: %v", out.String(), err)
+			}
+			if got.Command != test.command || got.Kind != test.kind {
+				t.Errorf("got command %q and kind %q, want %q and %q", got.Command, got.Kind, test.command, test.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// The flaghelpers package provides flag.Value implementations for
+// common validated flag types, for use in a Config's DeclareFlags.
+package flaghelpers
+
+import (
+	"errors"
+	"flag"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// urlValue is the flag.Value defined by URLVar.
+type urlValue struct {
+	p *url.URL
+}
+
+func (u urlValue) Set(s string) error {
+	parsed, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsAbs() {
+		return errors.New("must be an absolute URL")
+	}
+	*u.p = *parsed
+	return nil
+}
+
+func (u urlValue) String() string {
+	if u.p == nil {
+		return ""
+	}
+	return u.p.String()
+}
+
+// URLVar defines a flag with the given name and usage in flagSet whose
+// value must be an absolute URL, such as https://example.com/, and is
+// stored in p.
+func URLVar(flagSet *flag.FlagSet, p *url.URL, name string, usage string) {
+	flagSet.Var(urlValue{p}, name, usage)
+}
+
+// filePathValue is the flag.Value defined by FilePathVar.
+type filePathValue struct {
+	p *string
+}
+
+func (f filePathValue) Set(s string) error {
+	if _, err := os.Stat(s); err != nil {
+		return err
+	}
+	*f.p = s
+	return nil
+}
+
+func (f filePathValue) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return *f.p
+}
+
+// FilePathVar defines a flag with the given name and usage in flagSet
+// whose value must be the path of an existing file or directory, and
+// is stored in p. The path is checked when the flag is parsed, so the
+// file may still be removed before it is used.
+func FilePathVar(flagSet *flag.FlagSet, p *string, name string, usage string) {
+	flagSet.Var(filePathValue{p}, name, usage)
+}
+
+// portValue is the flag.Value defined by PortVar.
+type portValue struct {
+	p *int
+}
+
+func (v portValue) Set(s string) error {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return errors.New("must be a port number from 1 to 65535")
+	}
+	*v.p = port
+	return nil
+}
+
+func (v portValue) String() string {
+	if v.p == nil || *v.p == 0 {
+		return ""
+	}
+	return strconv.Itoa(*v.p)
+}
+
+// PortVar defines a flag with the given name and usage in flagSet
+// whose value must be a TCP or UDP port number from 1 to 65535, and is
+// stored in p.
+func PortVar(flagSet *flag.FlagSet, p *int, name string, usage string) {
+	flagSet.Var(portValue{p}, name, usage)
+}
@@ -0,0 +1,89 @@
+package flaghelpers
+
+import (
+	"flag"
+	"io"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+// parse declares a flag with declare in a new FlagSet and parses
+// the given value for it.
+func parse(declare func(*flag.FlagSet), value string) error {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	declare(flagSet)
+	return flagSet.Parse([]string{"-f", value})
+}
+
+func TestURLVar(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"https://example.com/path?q=1", true},
+		{"file:///tmp/x", true},
+		{"example.com", false},
+		{"/relative/path", false},
+		{"http://[::1", false},
+	}
+	for _, test := range tests {
+		var u url.URL
+		err := parse(func(fs *flag.FlagSet) { URLVar(fs, &u, "f", "") }, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parsing %q returned %v, want valid = %v", test.value, err, test.valid)
+		}
+		if test.valid && u.String() != test.value {
+			t.Errorf("parsing %q stored %q", test.value, u.String())
+		}
+	}
+}
+
+func TestFilePathVar(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{dir, true},
+		{filepath.Join(dir, "missing"), false},
+		{"", false},
+	}
+	for _, test := range tests {
+		var path string
+		err := parse(func(fs *flag.FlagSet) { FilePathVar(fs, &path, "f", "") }, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parsing %q returned %v, want valid = %v", test.value, err, test.valid)
+		}
+		if test.valid && path != test.value {
+			t.Errorf("parsing %q stored %q", test.value, path)
+		}
+	}
+}
+
+func TestPortVar(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		valid bool
+	}{
+		{"1", 1, true},
+		{"8080", 8080, true},
+		{"65535", 65535, true},
+		{"0", 0, false},
+		{"65536", 0, false},
+		{"-1", 0, false},
+		{"http", 0, false},
+	}
+	for _, test := range tests {
+		var port int
+		err := parse(func(fs *flag.FlagSet) { PortVar(fs, &port, "f", "") }, test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("parsing %q returned %v, want valid = %v", test.value, err, test.valid)
+		}
+		if port != test.want {
+			t.Errorf("parsing %q stored %d, want %d", test.value, port, test.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package subcommander
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A CountValue is a flag.Value that counts the times its flag is
+// given, so that -v -v -v sets it to 3. It acts as a boolean flag and
+// needs no value, but -v=false resets the count to zero and -v=n sets
+// it to n. The flag package does not support bundling, so -vvv is
+// not understood.
+type CountValue int
+
+// Set increments the count, or sets it as described for CountValue.
+func (c *CountValue) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*c = CountValue(n)
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if b {
+		*c++
+	} else {
+		*c = 0
+	}
+	return nil
+}
+
+func (c *CountValue) String() string {
+	if c == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*c))
+}
+
+// IsBoolFlag lets the flag be given without a value.
+func (c *CountValue) IsBoolFlag() bool { return true }
+
+// CountVar defines a counting flag with the given name and usage in
+// flagSet. The number of times the flag is given is stored in p.
+func CountVar(flagSet *flag.FlagSet, p *int, name string, usage string) {
+	flagSet.Var((*CountValue)(p), name, usage)
+}
+
+// A StringSlice is a flag.Value that collects every value given for
+// its flag, so that -tag a -tag b yields []string{"a", "b"}.
+type StringSlice []string
+
+// Set appends value to the slice.
+func (s *StringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *StringSlice) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+// StringSliceVar defines a repeatable string flag with the given name
+// and usage in flagSet. Each value given for the flag is appended to
+// the slice p points to.
+func StringSliceVar(flagSet *flag.FlagSet, p *[]string, name string, usage string) {
+	flagSet.Var((*StringSlice)(p), name, usage)
+}
+
+// A StringMap is a flag.Value that collects key=value pairs given for
+// its flag, so that -env FOO=bar -env BAZ=qux yields a map with the
+// keys FOO and BAZ. A later value for a key replaces an earlier one.
+type StringMap map[string]string
+
+// Set adds the key=value pair in value to the map, creating the map
+// if needed. It returns an error if value contains no "=".
+func (m *StringMap) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return errors.New("expected key=value")
+	}
+	if *m == nil {
+		*m = StringMap{}
+	}
+	(*m)[key] = val
+	return nil
+}
+
+func (m *StringMap) String() string {
+	if m == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*m))
+	for key, val := range *m {
+		pairs = append(pairs, key+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// StringMapVar defines a repeatable key=value flag with the given name
+// and usage in flagSet. Each pair given for the flag is added to the
+// map p points to.
+func StringMapVar(flagSet *flag.FlagSet, p *map[string]string, name string, usage string) {
+	flagSet.Var((*StringMap)(p), name, usage)
+}
+
+// An EnumValue is a flag.Value whose value must be one of Allowed.
+// Value holds the current value; set it before declaring the flag to
+// give a default.
+type EnumValue struct {
+	Allowed []string
+	Value   string
+}
+
+// Set sets Value to s, or returns an error listing the allowed values
+// if s is not one of them.
+func (e *EnumValue) Set(s string) error {
+	for _, allowed := range e.Allowed {
+		if s == allowed {
+			e.Value = s
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %s", strings.Join(e.Allowed, ", "))
+}
+
+func (e *EnumValue) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.Value
+}
+
+// EnumVar defines a flag with the given name and usage in flagSet
+// whose values are restricted to p.Allowed and stored in p.Value. The
+// allowed values are appended to the usage text.
+func EnumVar(flagSet *flag.FlagSet, p *EnumValue, name string, usage string) {
+	flagSet.Var(p, name, fmt.Sprintf("%s (one of %s)", usage, strings.Join(p.Allowed, "|")))
+}
+
+// negatedBool is a flag.Value that sets the bool it points to to the
+// opposite of the value it is given.
+type negatedBool struct {
+	p *bool
+}
+
+func (n negatedBool) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*n.p = !b
+	return nil
+}
+
+// String returns the empty string, so that no default is shown for
+// the negated flag in usage.
+func (n negatedBool) String() string { return "" }
+
+func (n negatedBool) IsBoolFlag() bool { return true }
+
+// BoolWithNegationVar defines a bool flag with the given name, default
+// value, and usage in flagSet, together with a flag named "no-"
+// followed by name, so that -name sets p to true and -no-name sets it
+// to false. If both are given, the last one wins.
+func BoolWithNegationVar(flagSet *flag.FlagSet, p *bool, name string, value bool, usage string) {
+	flagSet.BoolVar(p, name, value, usage)
+	flagSet.Var(negatedBool{p}, "no-"+name, "disable -"+name)
+}
+
+// fileOrLiteral is the flag.Value defined by FileOrLiteralReaderVar.
+type fileOrLiteral struct {
+	p     *string
+	stdin io.Reader
+}
+
+func (f fileOrLiteral) Set(s string) error {
+	var data []byte
+	var err error
+	switch {
+	case s == "-":
+		data, err = io.ReadAll(f.stdin)
+	case strings.HasPrefix(s, "@"):
+		data, err = os.ReadFile(s[1:])
+	default:
+		*f.p = s
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*f.p = string(data)
+	return nil
+}
+
+func (f fileOrLiteral) String() string {
+	if f.p == nil {
+		return ""
+	}
+	return *f.p
+}
+
+// FileOrLiteralVar defines a string flag with the given name and usage
+// in flagSet whose value is stored in p. A value of the form @path is
+// replaced by the contents of the file at path, and a value of - by
+// everything read from standard input; any other value is used as is.
+// A file that cannot be read makes flag parsing fail with the read
+// error. Standard input is always the process's os.Stdin, not the In
+// stream of a CommandSet's IO; use FileOrLiteralReaderVar to read
+// another stream.
+func FileOrLiteralVar(flagSet *flag.FlagSet, p *string, name string, usage string) {
+	FileOrLiteralReaderVar(flagSet, p, name, usage, os.Stdin)
+}
+
+// FileOrLiteralReaderVar is like FileOrLiteralVar, but a value of - is
+// replaced by everything read from stdin, such as the In stream of a
+// CommandSet's IO.
+func FileOrLiteralReaderVar(flagSet *flag.FlagSet, p *string, name string, usage string, stdin io.Reader) {
+	flagSet.Var(fileOrLiteral{p, stdin}, name, usage)
+}
@@ -0,0 +1,125 @@
+package subcommander
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestFlagSet returns a FlagSet that reports errors without
+// printing them.
+func newTestFlagSet() *flag.FlagSet {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	return flagSet
+}
+
+func TestCountVar(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, 0},
+		{[]string{"-v"}, 1},
+		{[]string{"-v", "-v"}, 2},
+		{[]string{"-v", "-v", "-v"}, 3},
+		{[]string{"-v=3"}, 3},
+		{[]string{"-v", "-v=false"}, 0},
+		{[]string{"-v=false", "-v"}, 1},
+	}
+	for _, test := range tests {
+		var count int
+		flagSet := newTestFlagSet()
+		CountVar(flagSet, &count, "v", "verbosity")
+		if err := flagSet.Parse(test.args); err != nil {
+			t.Errorf("parsing %q returned %v", test.args, err)
+			continue
+		}
+		if count != test.want {
+			t.Errorf("parsing %q counted %d, want %d", test.args, count, test.want)
+		}
+	}
+}
+
+func TestCountVarRejectsOtherValues(t *testing.T) {
+	var count int
+	flagSet := newTestFlagSet()
+	CountVar(flagSet, &count, "v", "verbosity")
+	if err := flagSet.Parse([]string{"-v=lots"}); err == nil {
+		t.Error("parsing -v=lots returned no error")
+	}
+}
+
+func TestStringSliceVar(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, nil},
+		{[]string{"-tag", "a"}, []string{"a"}},
+		{[]string{"-tag", "a", "-tag", "b", "-tag=c"}, []string{"a", "b", "c"}},
+		{[]string{"-tag", "a,b"}, []string{"a,b"}},
+	}
+	for _, test := range tests {
+		var tags []string
+		flagSet := newTestFlagSet()
+		StringSliceVar(flagSet, &tags, "tag", "a tag")
+		if err := flagSet.Parse(test.args); err != nil {
+			t.Errorf("parsing %q returned %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(tags, test.want) {
+			t.Errorf("parsing %q collected %q, want %q", test.args, tags, test.want)
+		}
+	}
+}
+
+func TestStringSliceDefault(t *testing.T) {
+	var tags []string
+	flagSet := newTestFlagSet()
+	StringSliceVar(flagSet, &tags, "tag", "a tag")
+	if f := flagSet.Lookup("tag"); f.DefValue != "" {
+		t.Errorf("the default is shown as %q, want the empty string", f.DefValue)
+	}
+	if err := flagSet.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 0 {
+		t.Errorf("got %q without the flag, want no values", tags)
+	}
+}
+
+func TestFileOrLiteralReaderVar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "body")
+	if err := os.WriteFile(path, []byte("from a file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		want  string
+		valid bool
+	}{
+		{"literal", "literal", true},
+		{"", "", true},
+		{"@" + path, "from a file", true},
+		{"-", "from stdin", true},
+		{"@" + path + ".missing", "", false},
+		{"@", "", false},
+	}
+	for _, test := range tests {
+		var body string
+		flagSet := newTestFlagSet()
+		FileOrLiteralReaderVar(flagSet, &body, "body", "a body", strings.NewReader("from stdin"))
+		err := flagSet.Parse([]string{"-body", test.value})
+		if (err == nil) != test.valid {
+			t.Errorf("parsing %q returned %v, want valid = %v", test.value, err, test.valid)
+		}
+		if body != test.want {
+			t.Errorf("parsing %q stored %q, want %q", test.value, body, test.want)
+		}
+	}
+}
@@ -1,3 +1,3 @@
 module github.com/mechfish/subcommander
 
-go 1.16
+go 1.21
@@ -0,0 +1,51 @@
+package subcommander
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+// IO holds the standard streams that a RunIO handler reads and writes.
+// Nil streams default to os.Stdin, os.Stdout, and os.Stderr.
+type IO struct {
+	In  io.Reader
+	Out io.Writer
+	Err io.Writer
+}
+
+// withDefaults returns a copy of s with nil streams replaced by the
+// process's standard streams.
+func (s IO) withDefaults() IO {
+	if s.In == nil {
+		s.In = os.Stdin
+	}
+	if s.Out == nil {
+		s.Out = os.Stdout
+	}
+	if s.Err == nil {
+		s.Err = os.Stderr
+	}
+	return s
+}
+
+// TestStreams is an IO backed by in-memory buffers, for use in tests.
+type TestStreams struct {
+	IO
+	out, err bytes.Buffer
+}
+
+// TestIO returns TestStreams whose In reads the given input and whose
+// Out and Err are captured.
+func TestIO(input string) *TestStreams {
+	s := &TestStreams{}
+	s.IO = IO{In: strings.NewReader(input), Out: &s.out, Err: &s.err}
+	return s
+}
+
+// Stdout returns everything written to Out so far.
+func (s *TestStreams) Stdout() string { return s.out.String() }
+
+// Stderr returns everything written to Err so far.
+func (s *TestStreams) Stderr() string { return s.err.String() }
@@ -0,0 +1,33 @@
+package subcommander
+
+import "fmt"
+
+// MergeCommandSets returns a CommandSet with the given name that
+// combines sets under one program. Each set becomes a group command
+// named by the set's Name, so that a command "get" of a set named
+// "pods" is run as "name pods get". The commands keep their handlers,
+// and their flags are declared by the Config given to Execute as
+// usual, with the set's name as part of the program name in usage.
+//
+// It is an error for a set to have no Name, for two sets to have the
+// same Name, or for a set to fail Validate.
+func MergeCommandSets(name string, sets ...*CommandSet) (*CommandSet, error) {
+	merged := &CommandSet{Name: name}
+	for i, set := range sets {
+		if set.Name == "" {
+			return nil, fmt.Errorf("Command set %d has no Name to merge it under", i)
+		}
+		if merged.hasCommand(set.Name) {
+			return nil, fmt.Errorf("More than one command set is named %q", set.Name)
+		}
+		if err := set.Validate(); err != nil {
+			return nil, fmt.Errorf("The %q command set is invalid: %w", set.Name, err)
+		}
+		sub := *set
+		sub.Name = ""
+		if err := merged.Add(Command{Name: set.Name, SubCommands: &sub}); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,39 @@
+package subcommander
+
+import "io"
+
+// An Option configures a CommandSet built by NewCommandSet.
+type Option func(*CommandSet)
+
+// NewCommandSet returns a CommandSet with the given program name,
+// configured by opts. It is equivalent to setting the corresponding
+// fields of a CommandSet literal, which remains supported.
+func NewCommandSet(name string, opts ...Option) *CommandSet {
+	cs := &CommandSet{Name: name}
+	for _, opt := range opts {
+		opt(cs)
+	}
+	return cs
+}
+
+// WithCommands adds commands to the set.
+func WithCommands(commands ...Command) Option {
+	return func(cs *CommandSet) { cs.Commands = append(cs.Commands, commands...) }
+}
+
+// WithOutput sets the writer for usage and error text.
+func WithOutput(w io.Writer) Option {
+	return func(cs *CommandSet) { cs.Output = w }
+}
+
+// WithArgs sets the argument vector that Execute and ExecuteContext
+// dispatch, in place of os.Args. As with os.Args, args[0] is the
+// program name.
+func WithArgs(args []string) Option {
+	return func(cs *CommandSet) { cs.args = args }
+}
+
+// WithDefaultCommand sets the command run when no command is named.
+func WithDefaultCommand(name string) Option {
+	return func(cs *CommandSet) { cs.DefaultCommandName = name }
+}
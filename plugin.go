@@ -0,0 +1,73 @@
+package subcommander
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// pluginCategory is the usage heading for plugins.
+const pluginCategory = "Plugins"
+
+// pluginNames returns the names of the plugins found on PATH, without
+// the PluginPrefix, in sorted order. The list is computed once and
+// then cached.
+func (cs *CommandSet) pluginNames() []string {
+	if cs.plugins == nil {
+		plugins := findPlugins(cs.PluginPrefix)
+		cs.plugins = &plugins
+	}
+	return *cs.plugins
+}
+
+// findPlugins returns the names, without the prefix, of the
+// executables on PATH whose names start with prefix.
+func findPlugins(prefix string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			if !strings.HasPrefix(name, prefix) || len(name) == len(prefix) || seen[name] {
+				continue
+			}
+			if _, err := exec.LookPath(filepath.Join(dir, entry.Name())); err != nil {
+				continue
+			}
+			seen[name] = true
+			names = append(names, strings.TrimPrefix(name, prefix))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runPlugin runs the plugin named PluginPrefix followed by name, if
+// one is on PATH, passing it args and the set's IO streams. It reports
+// whether a plugin was found. If the plugin exits unsuccessfully, the
+// error is an *exec.ExitError, whose ExitCode method makes ExitCodeFor
+// return the plugin's exit code.
+func (cs *CommandSet) runPlugin(ctx context.Context, name string, args []string) (bool, error) {
+	if cs.PluginPrefix == "" || name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return false, nil
+	}
+	path, err := exec.LookPath(cs.PluginPrefix + name)
+	if err != nil {
+		return false, nil
+	}
+	streams := cs.IO.withDefaults()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = streams.In, streams.Out, streams.Err
+	return true, cmd.Run()
+}
@@ -0,0 +1,47 @@
+package subcommander
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// numArgsNeeded returns how many non-flag arguments the command needs:
+// NumArgsRequired, or more if a later ArgSpec is Required.
+func (c *Command) numArgsNeeded() int {
+	needed := c.NumArgsRequired
+	for i, spec := range c.ArgSpecs {
+		if spec.Required && i+1 > needed {
+			needed = i + 1
+		}
+	}
+	return needed
+}
+
+// promptForArgs returns args extended with values read from the
+// user for any missing required arguments, if the command sets
+// PromptForMissingArgs and streams.In is a terminal. Otherwise, or if
+// the input ends early, it returns args with fewer values than needed,
+// for the usual checks to reject.
+func (c *Command) promptForArgs(streams IO, args []string) []string {
+	needed := c.numArgsNeeded()
+	if !c.PromptForMissingArgs || len(args) >= needed || !isTerminal(streams.In) {
+		return args
+	}
+	reader := bufio.NewReader(streams.In)
+	for i := len(args); i < needed; i++ {
+		name := fmt.Sprintf("argument %d", i+1)
+		if i < len(c.ArgSpecs) {
+			name = c.ArgSpecs[i].Name
+		}
+		fmt.Fprintf(streams.Err, "%s: ", name)
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" && err != nil {
+			fmt.Fprintln(streams.Err)
+			return args
+		}
+		args = append(args, line)
+	}
+	return args
+}
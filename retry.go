@@ -0,0 +1,49 @@
+package subcommander
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// A RetryPolicy says how often a command's handler is run again after
+// it fails with a Retryable error. The zero value means no retries.
+type RetryPolicy struct {
+	// Max is the number of times the handler is run again after its
+	// first failure.
+	Max int
+	// Backoff is how long to wait before each retry.
+	Backoff time.Duration
+}
+
+// A Retryable is an error that reports whether the operation that
+// failed may succeed if it is tried again, such as a timeout talking
+// to a server.
+type Retryable interface {
+	IsRetryable() bool
+}
+
+// isRetryable reports whether err, or an error it wraps, is a
+// Retryable that can be retried.
+func isRetryable(err error) bool {
+	var retryable Retryable
+	return errors.As(err, &retryable) && retryable.IsRetryable()
+}
+
+// runRetrying calls runHandler, running it again as the command's
+// Retry policy allows while it fails with a Retryable error. It stops
+// waiting for a retry, and returns the last error, if ctx is done.
+func (c *Command) runRetrying(ctx context.Context, streams IO, conf Config, parsed *ParsedArgs) error {
+	err := c.runHandler(ctx, streams, conf, parsed)
+	for retries := 0; retries < c.Retry.Max && isRetryable(err); retries++ {
+		timer := time.NewTimer(c.Retry.Backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = c.runHandler(ctx, streams, conf, parsed)
+	}
+	return err
+}
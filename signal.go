@@ -0,0 +1,27 @@
+package subcommander
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ExecuteContextWithSignals is like ExecuteContext, but with a context
+// that is canceled when the process receives one of sigs, or SIGINT or
+// SIGTERM if no sigs are given, so that a RunContext handler can stop
+// its work cleanly when interrupted. Once the first signal has been
+// caught, the signals regain their default behavior, so a second one
+// ends the process immediately.
+func (cs *CommandSet) ExecuteContextWithSignals(conf Config, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), sigs...)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return cs.ExecuteContext(ctx, conf)
+}
@@ -0,0 +1,24 @@
+// The subcommandertest package provides helpers for testing programs
+// built with subcommander.
+package subcommandertest
+
+import (
+	"github.com/mechfish/subcommander"
+)
+
+// Run dispatches the full argument vector args, including the program
+// name at args[0], to a copy of cs whose Output and IO streams are
+// captured, and returns what was written to standard output and
+// standard error along with the error from dispatch. Help that args
+// ask for is captured as standard output, and other usage text as
+// standard error. The handler's standard input is empty.
+//
+// Run does not modify cs or any global state.
+func Run(cs *subcommander.CommandSet, conf subcommander.Config, args []string) (stdout string, stderr string, err error) {
+	streams := subcommander.TestIO("")
+	set := *cs
+	set.IO = streams.IO
+	set.Output = streams.Err
+	err = set.ExecuteArgs(conf, args)
+	return streams.Stdout(), streams.Stderr(), err
+}
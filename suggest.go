@@ -0,0 +1,79 @@
+package subcommander
+
+import (
+	"flag"
+	"strings"
+)
+
+// maxSuggestionDistance is the largest edit distance at which a
+// mistyped name is considered close enough to suggest a correction.
+const maxSuggestionDistance = 2
+
+// suggest returns the candidate closest to the given name, or the
+// empty string if no candidate is within maxSuggestionDistance. A
+// candidate must also be fewer edits away than name is long, so that
+// short names are not "corrected" to unrelated ones.
+func suggest(name string, candidates []string) string {
+	best, bestDistance := "", maxSuggestionDistance+1
+	if n := len([]rune(name)); n < bestDistance {
+		bestDistance = n
+	}
+	for _, candidate := range candidates {
+		if d := levenshtein(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// undefinedFlagPrefix begins the flag package's error for a flag
+// that is not defined.
+const undefinedFlagPrefix = "flag provided but not defined: -"
+
+// suggestFlag returns the declared flag closest to the undefined flag
+// named in err, or the empty string if err is not about an undefined
+// flag or no declared flag is close enough.
+func suggestFlag(flagSet *flag.FlagSet, err error) string {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, undefinedFlagPrefix) {
+		return ""
+	}
+	name := strings.TrimPrefix(msg, undefinedFlagPrefix)
+	var names []string
+	flagSet.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	return suggest(name, names)
+}
+
+// levenshtein returns the edit distance between the strings a and b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,198 @@
+package subcommander
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// defaultCategory is the heading for commands without a Category.
+const defaultCategory = "Commands"
+
+// minNameWidth is the narrowest the command name column may be.
+const minNameWidth = 12
+
+// A commandGroup is a list of commands shown under one heading.
+type commandGroup struct {
+	Heading  string
+	Commands []*Command
+}
+
+// commandGroups returns the commands grouped for the top-level
+// usage, leaving out Hidden and Deprecated commands unless showHidden
+// is set. If no command has a category, there is a single group, in
+// declaration order unless SortCommands is set. Otherwise
+// uncategorized commands come first, followed by each category in
+// sorted order, and the commands in each group are sorted by name.
+func (cs *CommandSet) commandGroups(showHidden bool) []commandGroup {
+	byCategory := map[string][]*Command{}
+	for i := range cs.Commands {
+		command := &cs.Commands[i]
+		if showHidden || command.listed() {
+			category := command.category()
+			byCategory[category] = append(byCategory[category], command)
+		}
+	}
+	uncategorized := byCategory[""]
+	delete(byCategory, "")
+	if len(byCategory) == 0 {
+		if cs.SortCommands {
+			sortCommands(uncategorized)
+		}
+		return []commandGroup{{Heading: defaultCategory, Commands: uncategorized}}
+	}
+	var groups []commandGroup
+	if len(uncategorized) > 0 {
+		groups = append(groups, commandGroup{Heading: defaultCategory, Commands: uncategorized})
+	}
+	var categories []string
+	for category := range byCategory {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		groups = append(groups, commandGroup{Heading: category, Commands: byCategory[category]})
+	}
+	for _, group := range groups {
+		sortCommands(group.Commands)
+	}
+	return groups
+}
+
+// pluginGroup returns a group listing the plugins found on PATH, if
+// the set has a PluginPrefix and any plugins that do not share a name
+// with a command.
+func (cs *CommandSet) pluginGroup() (commandGroup, bool) {
+	if cs.PluginPrefix == "" {
+		return commandGroup{}, false
+	}
+	group := commandGroup{Heading: pluginCategory}
+	for _, name := range cs.pluginNames() {
+		if !cs.hasCommand(name) {
+			group.Commands = append(group.Commands, &Command{Name: name})
+		}
+	}
+	return group, len(group.Commands) > 0
+}
+
+// category returns the heading the command is listed under: its
+// Category, or for a name such as "remote/add", the part before the
+// first slash. The empty string means the default heading.
+func (c *Command) category() string {
+	if c.Category != "" {
+		return c.Category
+	}
+	if i := strings.Index(c.Name, "/"); i > 0 {
+		return c.Name[:i]
+	}
+	return ""
+}
+
+// listed reports whether the command appears in the default top-level
+// usage, which leaves out Hidden and Deprecated commands.
+func (c *Command) listed() bool {
+	return !c.Hidden && c.Deprecated == ""
+}
+
+func sortCommands(commands []*Command) {
+	sort.SliceStable(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+}
+
+// nameWidth returns the width of the command name column: wide
+// enough for the longest label in groups, and at least minNameWidth.
+func nameWidth(groups []commandGroup) int {
+	width := minNameWidth
+	for _, group := range groups {
+		for _, command := range group.Commands {
+			if n := utf8.RuneCountInString(command.label()); n > width {
+				width = n
+			}
+		}
+	}
+	return width
+}
+
+// UsageData is the data passed to a CommandSet's UsageTemplate.
+// ShowHidden is set when the user asked for every command to be
+// listed, including Hidden and Deprecated ones.
+type UsageData struct {
+	Name       string
+	Version    string
+	Commands   []UsageCommand
+	ShowHidden bool
+}
+
+// UsageCommand describes one command in UsageData.
+type UsageCommand struct {
+	Name        string
+	Aliases     []string
+	Description string
+	ArgsUsage   string
+	Hidden      bool
+	Deprecated  bool
+}
+
+// DefaultUsageTemplate is a template for the top-level usage, for use
+// as a starting point for a CommandSet's UsageTemplate. It lists the
+// commands in declaration order, without the column alignment and
+// grouping of the built-in usage.
+var DefaultUsageTemplate = template.Must(template.New("usage").Parse(`Usage:
+	{{.Name}} <command> [arguments]
+
+Commands:
+
+{{range .Commands}}{{if or $.ShowHidden (not (or .Hidden .Deprecated))}}    {{.Name}}
+	{{- if .Aliases}} ({{range $i, $alias := .Aliases}}{{if $i}}, {{end}}{{$alias}}{{end}}){{end}}
+	{{- with .Description}} - {{.}}{{end}}
+{{end}}{{end}}`))
+
+// usageData returns the data for the set's UsageTemplate.
+func (cs *CommandSet) usageData(showHidden bool) UsageData {
+	data := UsageData{Name: cs.name(), Version: cs.Version, ShowHidden: showHidden}
+	for _, command := range cs.Commands {
+		data.Commands = append(data.Commands, UsageCommand{
+			Name:        command.Name,
+			Aliases:     command.Aliases,
+			Description: command.summary(),
+			ArgsUsage:   command.argsUsage(),
+			Hidden:      command.Hidden,
+			Deprecated:  command.Deprecated != "",
+		})
+	}
+	return data
+}
+
+// printTopLevelUsage writes the usage of the whole set to out, listing
+// Hidden and Deprecated commands only if showHidden is set.
+func (cs *CommandSet) printTopLevelUsage(out io.Writer, showHidden bool) {
+	if cs.UsageTemplate != nil {
+		if err := cs.UsageTemplate.Execute(out, cs.usageData(showHidden)); err != nil {
+			fmt.Fprintf(out, "Could not print usage: %v\n", err)
+		}
+		return
+	}
+	s := newStyle(cs.Color, out)
+	groups := cs.commandGroups(showHidden)
+	if plugins, ok := cs.pluginGroup(); ok {
+		groups = append(groups, plugins)
+	}
+	width := nameWidth(groups)
+	indent := strings.Repeat(" ", width+4)
+	wrapWidth := cs.usageWidth(out) - len(indent)
+	fmt.Fprintf(out, "%s\n\t%s <command> [arguments]\n", s.heading("Usage:"), cs.name())
+	for _, group := range groups {
+		fmt.Fprintf(out, "\n%s\n\n", s.heading(group.Heading+":"))
+		for _, command := range group.Commands {
+			label := command.label()
+			padding := strings.Repeat(" ", width-utf8.RuneCountInString(label))
+			lines := wrapText(command.summary(), wrapWidth)
+			fmt.Fprintf(out, "%s%s    %s\n", padding, s.name(label), s.dim(lines[0]))
+			for _, line := range lines[1:] {
+				fmt.Fprintf(out, "%s%s\n", indent, s.dim(line))
+			}
+		}
+	}
+}
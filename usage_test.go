@@ -0,0 +1,106 @@
+package subcommander
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with the named file in testdata, or
+// rewrites the file with got if -update is given.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s; got:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestTopLevelUsageAlignsNames(t *testing.T) {
+	cs := &CommandSet{Name: "tool", Color: ColorNever, Commands: []Command{
+		{Name: "ls", Description: "List things", Run: noop},
+		{Name: "synchronize-everything", Aliases: []string{"sync"}, Description: "Synchronize all the things", Run: noop},
+		{Name: "status", Description: "Show the status", Run: noop},
+	}}
+	var usage strings.Builder
+	cs.printTopLevelUsage(&usage, false)
+	checkGolden(t, "usage.golden", usage.String())
+}
+
+func TestHiddenCommandRunsButIsNotListed(t *testing.T) {
+	ran := false
+	cs := &CommandSet{Name: "tool", Commands: []Command{
+		{Name: "status", Description: "Show the status", Run: noop},
+		{Name: "debug-dump", Description: "Dump internal state", Hidden: true, Run: func(Config, []string) error { ran = true; return nil }},
+	}}
+	var usage strings.Builder
+	cs.printTopLevelUsage(&usage, false)
+	if strings.Contains(usage.String(), "debug-dump") {
+		t.Errorf("usage lists the hidden command:\n%s", usage.String())
+	}
+	if !strings.Contains(usage.String(), "status") {
+		t.Errorf("usage does not list the status command:\n%s", usage.String())
+	}
+	if err := cs.ExecuteArgs(nil, []string{"tool", "debug-dump"}); err != nil {
+		t.Fatalf("running the hidden command returned %v", err)
+	}
+	if !ran {
+		t.Error("the hidden command did not run")
+	}
+}
+
+func TestCommandUsageGolden(t *testing.T) {
+	cs := &CommandSet{Name: "tool", Color: ColorNever}
+	c := &Command{
+		Name:     "deploy",
+		LongHelp: "Deploy the current build.",
+		ArgSpecs: []ArgSpec{{Name: "env", Required: true}},
+		Examples: []string{"tool deploy prod"},
+		Run:      noop,
+	}
+	var usage strings.Builder
+	if err := cs.writeCommandUsage(&usage, c, "tool", &testConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "deploy-usage.golden", usage.String())
+}
+
+func TestUsageColor(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    ColorMode
+		noColor bool
+		colored bool
+	}{
+		{"never", ColorNever, false, false},
+		{"always", ColorAlways, false, true},
+		{"always with NO_COLOR", ColorAlways, true, true},
+		{"auto to a buffer", ColorAuto, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.noColor {
+				t.Setenv("NO_COLOR", "1")
+			}
+			cs := &CommandSet{Name: "tool", Color: test.mode, Commands: []Command{{Name: "status", Run: noop}}}
+			var usage strings.Builder
+			cs.printTopLevelUsage(&usage, false)
+			if colored := strings.Contains(usage.String(), "\x1b["); colored != test.colored {
+				t.Errorf("usage colored is %v, want %v:\n%q", colored, test.colored, usage.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package subcommander
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// invocationValues holds the values stored with WithValue during one
+// run of a command.
+type invocationValues struct {
+	sync.Mutex
+	values map[interface{}]interface{}
+}
+
+func newInvocationValues() *invocationValues {
+	return &invocationValues{values: map[interface{}]interface{}{}}
+}
+
+func (v *invocationValues) get(key interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	v.Lock()
+	defer v.Unlock()
+	value, ok := v.values[key]
+	return value, ok
+}
+
+func (v *invocationValues) set(key, value interface{}) {
+	v.Lock()
+	defer v.Unlock()
+	v.values[key] = value
+}
+
+// WithValue stores value under key for the run of the command that cmd
+// was passed for, so that a PreRun hook can pass state, such as an
+// authenticated client, to the command's handler and PostRun without
+// putting it in the long-lived Config. Keys follow the same rules as
+// for context.WithValue.
+//
+// cmd must be the *Command given to PreRun or PostRun, which is a copy
+// of the command made for that run; WithValue returns an error for any
+// other Command. Each run, even of the same command at the same time,
+// has values of its own, which are discarded when the run finishes.
+// They can be read with Value, with ParsedArgs.Value in a RunParsed
+// handler, and through the context passed to a RunContext handler.
+func WithValue(cmd *Command, key, value interface{}) error {
+	if cmd.values == nil {
+		return fmt.Errorf("The %q command is not being run, so it has no values", cmd.Name)
+	}
+	cmd.values.set(key, value)
+	return nil
+}
+
+// Value returns the value stored under key with WithValue for the run
+// of the command that cmd was passed for, or nil if there is none.
+func Value(cmd *Command, key interface{}) interface{} {
+	value, _ := cmd.values.get(key)
+	return value
+}
+
+// Value returns the value stored under key with WithValue for this
+// run of the command, or nil if there is none.
+func (p *ParsedArgs) Value(key interface{}) interface{} {
+	value, _ := p.values.get(key)
+	return value
+}
+
+// valuesContext is the context passed to a RunContext handler, which
+// also looks up keys in the values of the run.
+type valuesContext struct {
+	context.Context
+	values *invocationValues
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	if value, ok := c.values.get(key); ok {
+		return value
+	}
+	return c.Context.Value(key)
+}
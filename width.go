@@ -0,0 +1,57 @@
+package subcommander
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultTerminalWidth is the width assumed for a terminal whose size
+// cannot be found.
+const defaultTerminalWidth = 80
+
+// minWrapWidth is the narrowest that descriptions are wrapped to;
+// below it they are printed unwrapped.
+const minWrapWidth = 20
+
+// usageWidth returns the width to wrap the top-level usage written to
+// w to: UsageWidth if it is set, or else the width of the terminal if
+// w is one. It returns 0, meaning no wrapping, for other writers.
+func (cs *CommandSet) usageWidth(w io.Writer) int {
+	if cs.UsageWidth > 0 {
+		return cs.UsageWidth
+	}
+	if !isTerminal(w) {
+		return 0
+	}
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	f, _ := outputFile(w)
+	if width := terminalWidth(f); width > 0 {
+		return width
+	}
+	return defaultTerminalWidth
+}
+
+// wrapText splits text into lines of at most width runes, breaking
+// at spaces. A word longer than width gets a line of its own. If
+// width is less than minWrapWidth, text is returned as a single line.
+func wrapText(text string, width int) []string {
+	words := strings.Fields(text)
+	if width < minWrapWidth || len(words) == 0 {
+		return []string{text}
+	}
+	var lines []string
+	line := words[0]
+	for _, word := range words[1:] {
+		if len([]rune(line))+1+len([]rune(word)) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line += " " + word
+	}
+	return append(lines, line)
+}
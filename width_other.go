@@ -0,0 +1,11 @@
+//go:build !darwin && !freebsd && !linux && !netbsd && !openbsd
+
+package subcommander
+
+import "os"
+
+// terminalWidth returns 0, since the size of the terminal cannot be
+// found on this platform.
+func terminalWidth(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,22 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+
+package subcommander
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalWidth returns the number of columns of the terminal f, or 0
+// if it cannot be found.
+func terminalWidth(f *os.File) int {
+	var size struct {
+		rows, cols, xpixels, ypixels uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0
+	}
+	return int(size.cols)
+}